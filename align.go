@@ -0,0 +1,139 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// An aligner is an io.Writer that buffers lines of text results
+// and, when flushed, writes them to w with their columns aligned:
+// the names in the first column are padded to the same width,
+// and so are the offsets in the second column of lines such as
+// T.field 8 int. Lines beginning with # or a tab, such as the -sum
+// summary and the -map layouts, are written unchanged.
+type aligner struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+// alignOut is the aligner used for the results, or nil if -raw was given
+// or the output is JSON, CSV, or an -arch table.
+var alignOut *aligner
+
+func (a *aligner) Write(p []byte) (int, error) {
+	return a.buf.Write(p)
+}
+
+// Flush writes the buffered lines to a.w.
+func (a *aligner) Flush() error {
+	type line struct {
+		cols []string // name, offset, rest; fewer than 2 if unaligned
+		text string
+	}
+	var lines []line
+	width1, width2 := 0, 0
+	for _, text := range strings.SplitAfter(a.buf.String(), "\n") {
+		if text == "" {
+			continue
+		}
+		l := line{text: text}
+		body := strings.TrimSuffix(text, "\n")
+		if !strings.HasPrefix(body, "#") && !strings.HasPrefix(body, "\t") {
+			l.cols = splitCols(body)
+		}
+		if len(l.cols) > 1 {
+			if n := visibleLen(l.cols[0]); n > width1 {
+				width1 = n
+			}
+			if len(l.cols) == 3 && isNumber(l.cols[1]) && visibleLen(l.cols[1]) > width2 {
+				width2 = visibleLen(l.cols[1])
+			}
+		}
+		lines = append(lines, l)
+	}
+	a.buf.Reset()
+
+	var out strings.Builder
+	for _, l := range lines {
+		if len(l.cols) < 2 {
+			out.WriteString(l.text)
+			continue
+		}
+		out.WriteString(l.cols[0])
+		out.WriteString(strings.Repeat(" ", width1-visibleLen(l.cols[0])+1))
+		out.WriteString(l.cols[1])
+		if len(l.cols) == 3 {
+			if isNumber(l.cols[1]) {
+				out.WriteString(strings.Repeat(" ", width2-visibleLen(l.cols[1])))
+			}
+			out.WriteString(" ")
+			out.WriteString(l.cols[2])
+		}
+		out.WriteString("\n")
+	}
+	_, err := io.WriteString(a.w, out.String())
+	return err
+}
+
+// splitCols splits line into at most three space-separated columns.
+// Spaces within brackets, as in the name Pair[string, error],
+// do not separate columns. The brackets in -color escape sequences
+// are not counted.
+func splitCols(line string) []string {
+	var cols []string
+	depth, start := 0, 0
+	for i := 0; i < len(line) && len(cols) < 2; i++ {
+		switch line[i] {
+		case '\x1b':
+			for i < len(line) && line[i] != 'm' {
+				i++
+			}
+		case '[', '(', '{':
+			depth++
+		case ']', ')', '}':
+			depth--
+		case ' ':
+			if depth == 0 {
+				cols = append(cols, line[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(cols, line[start:])
+}
+
+// isNumber reports whether s, not counting -color escape sequences,
+// is a decimal or -hex number.
+func isNumber(s string) bool {
+	_, err := strconv.ParseInt(stripColor(s), 0, 64)
+	return err == nil
+}
+
+// visibleLen returns the length of s not counting -color escape sequences.
+func visibleLen(s string) int {
+	return len(stripColor(s))
+}
+
+// stripColor returns s without its -color escape sequences.
+func stripColor(s string) string {
+	if !strings.Contains(s, "\x1b") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\x1b' {
+			for i < len(s) && s[i] != 'm' {
+				i++
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,55 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"rsc.io/sizeof/layout"
+)
+
+// strategies lists the build strategies compared by -benchmark.
+var strategies = []layout.Strategy{layout.StrategyAsmhdr, layout.StrategyWork}
+
+// benchmark measures the packages named by paths n times with each
+// build strategy, bypassing the cache, and prints the average time
+// each strategy took, as requested by the hidden -benchmark flag.
+// A strategy that cannot obtain go_asm.h for a package is reported
+// as failing. It returns the exit status: 2 if every strategy
+// failed for some package, and 0 otherwise.
+func benchmark(paths []string, n int) int {
+	status := 0
+	for _, path := range paths {
+		name := path
+		if name == "" {
+			name = "."
+		}
+		ok := false
+		for _, s := range strategies {
+			opts := options(nil)
+			opts.NoCache = true
+			opts.Strategy = s
+			var total time.Duration
+			var err error
+			for i := 0; i < n && err == nil; i++ {
+				start := time.Now()
+				_, err = layout.Sizes(path, opts)
+				total += time.Since(start)
+			}
+			if err != nil {
+				fmt.Fprintf(stdout, "%s %s failed: %v\n", name, s, err)
+				continue
+			}
+			ok = true
+			fmt.Fprintf(stdout, "%s %s %d iterations, average %v\n", name, s, n, (total / time.Duration(n)).Round(time.Microsecond))
+		}
+		if !ok {
+			status = exitError
+		}
+	}
+	flushOutput()
+	return status
+}
@@ -0,0 +1,85 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strconv"
+
+	"rsc.io/sizeof/layout"
+)
+
+// A cachelineFlag is the -cacheline flag. It may be given alone,
+// as a boolean, to use 64-byte cache lines, or with a size, as in
+// -cacheline=128. Zero disables the cache line analysis.
+type cachelineFlag int64
+
+func (c *cachelineFlag) IsBoolFlag() bool { return true }
+
+func (c *cachelineFlag) String() string { return strconv.FormatInt(int64(*c), 10) }
+
+func (c *cachelineFlag) Set(s string) error {
+	switch s {
+	case "true":
+		*c = 64
+		return nil
+	case "false":
+		*c = 0
+		return nil
+	}
+	n, err := strconv.ParseInt(s, 0, 64)
+	if err != nil || n < 0 {
+		return strconv.ErrSyntax
+	}
+	*c = cachelineFlag(n)
+	return nil
+}
+
+// cachelines returns the number of cache lines of size bytes
+// spanned by a value of n bytes starting at the beginning of a line.
+func cachelines(n, size int64) int64 {
+	return (n + size - 1) / size
+}
+
+// A sharedLine lists the fields occupying a single cache line.
+type sharedLine struct {
+	Line   int64    `json:"line"`
+	Fields []string `json:"fields"`
+}
+
+// sharedLines returns the cache lines of size bytes in t that hold
+// more than one field, which are prone to false sharing when the fields
+// are written by different goroutines. A field spanning several cache
+// lines is listed in each. Zero-size fields occupy no cache line.
+// If t's field sizes are unknown, each field is assumed to occupy
+// only the line holding its first byte.
+func sharedLines(t *layout.Type, size int64) []sharedLine {
+	var lines []sharedLine
+	byLine := make(map[int64]int)
+	for _, f := range t.Fields {
+		first, last := f.Offset/size, f.Offset/size
+		if t.FieldSizes() {
+			if f.Size == 0 {
+				continue
+			}
+			last = (f.Offset + f.Size - 1) / size
+		}
+		for l := first; l <= last; l++ {
+			i, ok := byLine[l]
+			if !ok {
+				i = len(lines)
+				byLine[l] = i
+				lines = append(lines, sharedLine{Line: l})
+			}
+			lines[i].Fields = append(lines[i].Fields, f.Name)
+		}
+	}
+	shared := lines[:0]
+	for _, l := range lines {
+		if len(l.Fields) > 1 {
+			shared = append(shared, l)
+		}
+	}
+	return shared
+}
@@ -0,0 +1,206 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/token"
+	"os"
+	"strings"
+)
+
+// A subcommand is a mode selected by the first argument, as in sizeof consts,
+// as an alternative to the flags that select it.
+type subcommand struct {
+	name  string
+	flag  string // flag set by the subcommand
+	short string
+	not   []string // flags that do not apply
+}
+
+// typeFlags lists the flags that apply only to types,
+// which the consts subcommand rejects.
+var typeFlags = []string{
+	"align", "all", "biggest-field", "cacheline", "check-align", "cost", "deep",
+	"deeplen", "dot", "embed", "explain", "f", "fields-only", "flat", "iface",
+	"interfaces", "kind", "map", "max", "min-size", "no-tail-pad", "pad", "ptr",
+	"recursive", "reorder", "scan", "sizes-only", "symbols", "t", "template", "top",
+	"words",
+}
+
+// constFlags lists the flags that apply only to constants,
+// which the types and fields subcommands reject.
+// The -all flag, which prints both, is in both lists.
+var constFlags = []string{"all", "c", "prefix"}
+
+var subcommands = []*subcommand{
+	{"types", "", "print type sizes (the default)", constFlags},
+	{"consts", "c", "print constant values, like -c", typeFlags},
+	{"fields", "f", "print type sizes and field offsets, like -f", constFlags},
+}
+
+// hiddenFlags lists the flags omitted from the usage message,
+// which are meant for sizeof's maintainers.
+var hiddenFlags = []string{"benchmark"}
+
+// cmd is the subcommand named on the command line, or nil.
+var cmd *subcommand
+
+// pkgNames maps each -p argument to the names that follow it
+// on the command line, which apply only to the packages it names.
+var pkgNames = make(map[string][]string)
+
+// parseArgs parses the command line, which may begin with a subcommand,
+// and returns the names on it that apply to all packages.
+// Names may be interleaved with flags, as in
+//
+//	sizeof -p net/http Request Response -p net/url URL
+//
+// in which case the names following a -p flag are recorded in pkgNames.
+// Names before the first -p flag apply to all packages.
+// Flags not set on the command line take their values from the
+// configuration file, if any; see applyConfig.
+func parseArgs() []string {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		for _, sc := range subcommands {
+			if args[0] == sc.name {
+				cmd = sc
+				args = args[1:]
+				break
+			}
+		}
+	}
+	var names []string
+	for {
+		n := len(flagPkg)
+		flag.CommandLine.Parse(args)
+		args = flag.Args()
+		i := 0
+		for i < len(args) && !strings.HasPrefix(args[i], "-") {
+			i++
+		}
+		if n == len(flagPkg) {
+			names = append(names, args[:i]...)
+		} else {
+			for _, pkg := range flagPkg[n:] {
+				pkgNames[pkg] = append(pkgNames[pkg], args[:i]...)
+			}
+		}
+		if i == len(args) {
+			break
+		}
+		args = args[i:]
+	}
+	if cmd != nil {
+		flag.Visit(func(f *flag.Flag) {
+			for _, name := range cmd.not {
+				if f.Name == name {
+					fatalf("cannot use -%s with sizeof %s", f.Name, cmd.name)
+				}
+			}
+		})
+	}
+	applyConfig()
+	if cmd != nil && cmd.flag != "" {
+		flag.Set(cmd.flag, "true")
+	}
+	return names
+}
+
+// splitQualified moves the names that are qualified by an import path,
+// as in net/http.Request, from want and from the names following a -p flag
+// to pkgNames, adding their packages to the -p list as if each had been
+// given as -p net/http Request. The remaining names in want are still
+// sought in the current directory's package, unless -p was given,
+// in which case they are sought in every package as before.
+func splitQualified() {
+	var paths []string
+	split := func(names []string) []string {
+		var rest []string
+		for _, name := range names {
+			i := strings.LastIndex(name, ".")
+			if i <= 0 || strings.ContainsAny(name, "[] ") || !token.IsIdentifier(name[i+1:]) {
+				rest = append(rest, name)
+				continue
+			}
+			path := name[:i]
+			if !hasString(flagPkg, path) && !hasString(paths, path) {
+				paths = append(paths, path)
+			}
+			pkgNames[path] = append(pkgNames[path], name[i+1:])
+		}
+		return rest
+	}
+	for _, path := range flagPkg {
+		if names := pkgNames[path]; len(names) > 0 {
+			pkgNames[path] = split(names)
+		}
+	}
+	rest := split(want)
+	if len(flagPkg) == 0 && len(paths) > 0 {
+		// Seek the unqualified names in the current directory only,
+		// except for generic instantiations, which are measured
+		// in every package, like -expr.
+		var global, local []string
+		for _, name := range rest {
+			if instanceRE.MatchString(name) {
+				global = append(global, name)
+			} else {
+				local = append(local, name)
+			}
+		}
+		if len(local) > 0 {
+			flagPkg = append(flagPkg, "")
+			pkgNames[""] = local
+		}
+		rest = global
+	}
+	flagPkg = append(flagPkg, paths...)
+	want = rest
+}
+
+// hasString reports whether list contains s.
+func hasString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// printSubcommands prints the usage message's list of subcommands,
+// or, if a subcommand was given, the flags that apply to it.
+func printSubcommands() {
+	skip := make(map[string]bool)
+	for _, name := range hiddenFlags {
+		skip[name] = true
+	}
+	if cmd != nil {
+		fmt.Fprintf(os.Stderr, "usage: sizeof %s [options] [name...]\n", cmd.name)
+		for _, name := range cmd.not {
+			skip[name] = true
+		}
+		skip[cmd.flag] = true
+	} else {
+		fmt.Fprintf(os.Stderr, "usage: sizeof [command] [options] [name...]\n")
+		fmt.Fprintf(os.Stderr, "commands:\n")
+		for _, sc := range subcommands {
+			fmt.Fprintf(os.Stderr, "  %-8s%s\n", sc.name, sc.short)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "options:\n")
+	fs := flag.NewFlagSet("sizeof", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	flag.VisitAll(func(f *flag.Flag) {
+		if !skip[f.Name] {
+			fs.Var(f.Value, f.Name, f.Usage)
+			fs.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	fs.PrintDefaults()
+}
@@ -0,0 +1,59 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+)
+
+// ANSI escape sequences used by -color.
+const (
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorReset = "\x1b[0m"
+)
+
+// useColor records whether to color the output; see -color.
+var useColor bool
+
+// setColor sets useColor from the -color flag, the NO_COLOR environment
+// variable, and whether the results are going to a terminal.
+func setColor(out *os.File) {
+	switch *flagColor {
+	case "never":
+		return
+	case "always":
+		useColor = true
+	case "auto":
+		useColor = isTerminal(out)
+	default:
+		fatalf("invalid -color %q: must be auto, always, or never", *flagColor)
+	}
+	if os.Getenv("NO_COLOR") != "" || *flagJSON || *flagCSV {
+		useColor = false
+	}
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// colorPad returns line, the line printed for a type of the given size
+// with pad bytes of padding, colored according to the padding:
+// red if at least an eighth of the type is padding,
+// green if there is no padding at all.
+func colorPad(line string, size, pad int64) string {
+	switch {
+	case !useColor:
+		return line
+	case pad == 0:
+		return colorGreen + line + colorReset
+	case pad*8 >= size:
+		return colorRed + line + colorReset
+	}
+	return line
+}
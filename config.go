@@ -0,0 +1,121 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// configName is the name of the file holding default flag values.
+const configName = ".sizeof.json"
+
+// findConfig returns the name of the configuration file to read:
+// the -config file if given, or else the first of .sizeof.json in the
+// current directory and in the home directory that exists.
+// It returns "" if there is no configuration file.
+func findConfig() string {
+	if *flagConfig != "" {
+		return *flagConfig
+	}
+	dirs := []string{"."}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, home)
+	}
+	for _, dir := range dirs {
+		file := filepath.Join(dir, configName)
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	return ""
+}
+
+// applyConfig sets the flags named in the configuration file
+// to the values it gives, except for the flags set on the command line,
+// which override the file. The file holds a JSON object mapping flag names
+// to values: a boolean, number, or string, or a list of strings for a
+// repeatable flag such as -p, each of which is set in turn.
+// Flags that do not apply to the subcommand cmd are ignored.
+func applyConfig() {
+	file := findConfig()
+	if file == "" {
+		return
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fatal(err)
+	}
+	var config map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&config); err != nil {
+		fatalf("%s: %v", file, err)
+	}
+
+	skip := map[string]bool{"config": true}
+	flag.Visit(func(f *flag.Flag) {
+		skip[f.Name] = true
+	})
+	if cmd != nil {
+		for _, name := range cmd.not {
+			skip[name] = true
+		}
+	}
+	var names []string
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if flag.Lookup(name) == nil {
+			fatalf("%s: unknown flag -%s", file, name)
+		}
+		if skip[name] {
+			continue
+		}
+		values, err := configValues(config[name])
+		if err != nil {
+			fatalf("%s: -%s: %v", file, name, err)
+		}
+		for _, v := range values {
+			if err := flag.Set(name, v); err != nil {
+				fatalf("%s: -%s: %v", file, name, err)
+			}
+		}
+	}
+	if *flagVerbose {
+		log.Printf("using defaults from %s", file)
+	}
+}
+
+// configValues returns the flag values given by the configuration value v.
+func configValues(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case bool:
+		return []string{fmt.Sprint(v)}, nil
+	case json.Number:
+		return []string{v.String()}, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		var values []string
+		for _, x := range v {
+			s, ok := x.(string)
+			if !ok {
+				return nil, fmt.Errorf("list must hold only strings")
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("value must be a boolean, number, string, or list of strings")
+}
@@ -0,0 +1,65 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"strconv"
+	"strings"
+)
+
+// csvOut is the destination for -csv records.
+// It is created, and the header row printed, by the first record.
+var csvOut *csv.Writer
+
+// writeCSV writes the -csv record rec, preceded by the header row
+// if this is the first record.
+func writeCSV(rec ...string) {
+	if csvOut == nil {
+		csvOut = csv.NewWriter(stdout)
+		csvOut.Write(csvHeader())
+	}
+	csvOut.Write(rec)
+}
+
+// flushCSV flushes the -csv records written so far.
+// If there were none, it prints just the header row,
+// so that the columns are the same for every run.
+func flushCSV() {
+	if csvOut == nil {
+		csvOut = csv.NewWriter(stdout)
+		csvOut.Write(csvHeader())
+	}
+	csvOut.Flush()
+	if err := csvOut.Error(); err != nil {
+		fatal(err)
+	}
+}
+
+// csvHeader returns the -csv header row for types or constants,
+// according to the command line.
+func csvHeader() []string {
+	switch {
+	case *flagArch != "":
+		// One value column per architecture, for constants too.
+		return append([]string{"name"}, strings.Split(*flagArch, ",")...)
+	case *flagConst:
+		return []string{"name", "value"}
+	case *flagField:
+		return []string{"type", "field", "offset", "size"}
+	}
+	return []string{"name", "size"}
+}
+
+// csvValue returns the constant value val from go_asm.h for a -csv record.
+// Strings are unquoted; other values are unchanged.
+func csvValue(val string) string {
+	if strings.HasPrefix(val, `"`) {
+		if s, err := strconv.Unquote(val); err == nil {
+			return s
+		}
+	}
+	return val
+}
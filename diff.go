@@ -0,0 +1,215 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"rsc.io/sizeof/layout"
+)
+
+// diff builds the two configurations named by the -p, -arch, and -base flags
+// and prints the differences between them, as requested by -diff.
+// It reports whether there were any differences.
+func diff(paths []string) (bool, error) {
+	var archs []string
+	if *flagArch != "" {
+		archs = strings.Split(*flagArch, ",")
+	}
+	type config struct {
+		path string
+		env  []string
+		dir  string // directory holding the package, if path is empty
+	}
+	var old, new config
+	switch {
+	case *flagBase != "" && len(archs) == 0 && len(paths) == 1:
+		dir, cleanup, err := baseWorktree(paths[0], *flagBase)
+		if err != nil {
+			return false, err
+		}
+		defer cleanup()
+		old = config{"", nil, dir}
+		new = config{paths[0], nil, ""}
+	case *flagBase != "":
+		return false, fmt.Errorf("-base requires a single package and cannot be used with -arch")
+	case len(archs) == 2 && len(paths) == 1:
+		old = config{paths[0], []string{"GOARCH=" + archs[0]}, ""}
+		new = config{paths[0], []string{"GOARCH=" + archs[1]}, ""}
+	case len(archs) == 0 && len(paths) == 2:
+		old = config{paths[0], nil, ""}
+		new = config{paths[1], nil, ""}
+	default:
+		return false, fmt.Errorf("-diff requires two packages (-p old,new) or two architectures (-arch old,new)")
+	}
+
+	var ps [2]*layout.Package
+	for i, c := range []config{old, new} {
+		var err error
+		opts := options(c.env)
+		if c.dir != "" {
+			opts.Dir = c.dir
+		}
+		ps[i], err = load(c.path, opts)
+		if err != nil {
+			if c.dir != "" {
+				return false, fmt.Errorf("%s at %s: %v", c.dir, *flagBase, err)
+			}
+			return false, fmt.Errorf("%s%s: %v", strings.Join(append(c.env, ""), " "), c.path, err)
+		}
+	}
+	return diffPackages(ps[0], ps[1]), nil
+}
+
+// baseWorktree checks out the git revision rev into a temporary worktree,
+// for -base, and returns the directory in it holding the package named by path.
+// The caller must call cleanup to remove the worktree when done.
+// The user's own checkout is not modified.
+func baseWorktree(path, rev string) (dir string, cleanup func(), err error) {
+	pkgDir, err := layout.Dir(path, options(nil))
+	if err != nil {
+		return "", nil, err
+	}
+	if pkgDir, err = filepath.Abs(pkgDir); err != nil {
+		return "", nil, err
+	}
+	out, err := gitOutput(pkgDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", nil, fmt.Errorf("-base: %s is not in a git repository", pkgDir)
+	}
+	top := strings.TrimSpace(out)
+	rel, err := filepath.Rel(top, pkgDir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tmp, err := ioutil.TempDir(*flagTmpdir, "sizeof-base-")
+	if err != nil {
+		return "", nil, err
+	}
+	tree := filepath.Join(tmp, "tree")
+	if _, err := gitOutput(top, "worktree", "add", "--detach", tree, rev); err != nil {
+		os.RemoveAll(tmp)
+		return "", nil, fmt.Errorf("-base: %v", err)
+	}
+	cleanup = func() {
+		if _, err := gitOutput(top, "worktree", "remove", "--force", tree); err != nil && *flagVerbose {
+			log.Print(err)
+		}
+		os.RemoveAll(tmp)
+	}
+	dir = filepath.Join(tree, rel)
+	if _, err := os.Stat(dir); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("-base: package directory %s does not exist at %s", rel, rev)
+	}
+	if *flagVerbose {
+		log.Printf("checked out %s in %s", rev, tree)
+	}
+	return dir, cleanup, nil
+}
+
+// gitOutput runs git with the given arguments in dir
+// and returns its standard output.
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %v", args[0], err)
+	}
+	return string(out), nil
+}
+
+// diffPackages prints the differences between the types in old and new,
+// sorted by type name, with each type's fields following it.
+// It reports whether there were any differences.
+func diffPackages(old, new *layout.Package) bool {
+	type entry struct {
+		typ      string // name of the type, or of the type holding the field
+		name     string
+		old, new *int64
+	}
+	var list []*entry
+	byName := make(map[string]*entry)
+	add := func(typ, name string, n int64, isNew bool) {
+		e := byName[name]
+		if e == nil {
+			e = &entry{typ: typ, name: name}
+			byName[name] = e
+			list = append(list, e)
+		}
+		if isNew {
+			e.new = &n
+		} else {
+			e.old = &n
+		}
+	}
+	for _, p := range []*layout.Package{old, new} {
+		for _, t := range p.Types {
+			if !matchType(t) {
+				continue
+			}
+			add(t.Name, t.Name, t.Size, p == new)
+			if *flagField {
+				for _, f := range t.Fields {
+					add(t.Name, t.Name+"."+f.Name, f.Offset, p == new)
+				}
+			}
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].typ < list[j].typ
+	})
+
+	changed := false
+	for _, e := range list {
+		switch {
+		case e.old == nil:
+			changed = true
+			if *flagJSON {
+				jsonOut = append(jsonOut, jsonDiff{e.name, nil, e.new})
+				continue
+			}
+			fmt.Fprintf(stdout, "%s added %s\n", e.name, fmtInt(*e.new))
+		case e.new == nil:
+			changed = true
+			if *flagJSON {
+				jsonOut = append(jsonOut, jsonDiff{e.name, e.old, nil})
+				continue
+			}
+			fmt.Fprintf(stdout, "%s removed %s\n", e.name, fmtInt(*e.old))
+		case *e.old != *e.new:
+			changed = true
+			if *flagJSON {
+				jsonOut = append(jsonOut, jsonDiff{e.name, e.old, e.new})
+				continue
+			}
+			fmt.Fprintf(stdout, "%s %s -> %s (%s)\n", e.name, fmtInt(*e.old), fmtInt(*e.new), fmtDelta(*e.new-*e.old))
+		}
+	}
+	return changed
+}
+
+// A jsonDiff is the JSON form of a difference printed by -diff.
+// Old or New is null if the type was added or removed.
+type jsonDiff struct {
+	Name string `json:"name"`
+	Old  *int64 `json:"old"`
+	New  *int64 `json:"new"`
+}
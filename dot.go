@@ -0,0 +1,70 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"rsc.io/sizeof/layout"
+)
+
+// A dotGraph accumulates the Graphviz graph printed by -dot.
+type dotGraph struct {
+	lines []string        // node and edge statements, in order
+	seen  map[string]bool // names of nodes already added
+}
+
+// dotOut is the graph printed by -dot.
+var dotOut dotGraph
+
+// addType adds t to the graph, along with the types reachable from it.
+func (g *dotGraph) addType(t *layout.Type) {
+	root := t.Graph()
+	if root == nil {
+		root = &layout.Node{Name: t.Name, Size: t.Size}
+	}
+	g.add(root)
+}
+
+// add adds n to the graph, with an edge to each type it refers to,
+// and then adds those types in turn. An edge is labeled with the names
+// of the fields making the references.
+func (g *dotGraph) add(n *layout.Node) {
+	if g.seen == nil {
+		g.seen = make(map[string]bool)
+	}
+	if g.seen[n.Name] {
+		return
+	}
+	g.seen[n.Name] = true
+	g.lines = append(g.lines, fmt.Sprintf("%s [label=%s];", strconv.Quote(n.Name), strconv.Quote(n.Name+"\n"+fmtInt(n.Size))))
+
+	var targets []*layout.Node
+	fields := make(map[*layout.Node][]string)
+	for _, ref := range n.Refs {
+		if _, ok := fields[ref.To]; !ok {
+			targets = append(targets, ref.To)
+		}
+		fields[ref.To] = append(fields[ref.To], ref.Field)
+	}
+	for _, to := range targets {
+		g.lines = append(g.lines, fmt.Sprintf("%s -> %s [label=%s];", strconv.Quote(n.Name), strconv.Quote(to.Name), strconv.Quote(strings.Join(fields[to], ", "))))
+	}
+	for _, to := range targets {
+		g.add(to)
+	}
+}
+
+// print prints the graph.
+func (g *dotGraph) print() {
+	fmt.Fprintf(stdout, "digraph sizeof {\n")
+	fmt.Fprintf(stdout, "\tnode [shape=box];\n")
+	for _, line := range g.lines {
+		fmt.Fprintf(stdout, "\t%s\n", line)
+	}
+	fmt.Fprintf(stdout, "}\n")
+}
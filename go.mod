@@ -0,0 +1,3 @@
+module rsc.io/sizeof
+
+go 1.22
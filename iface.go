@@ -0,0 +1,144 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+
+	"rsc.io/sizeof/layout"
+)
+
+// ifaceType is the -iface interface, looked up in the package being printed,
+// and ifacePkg is that package, in which the printed types are found.
+var (
+	ifaceType *types.Interface
+	ifacePkg  *types.Package
+)
+
+// lookupIface finds the interface named by -iface in p: a name declared
+// in p, a predeclared name such as error, or a name qualified by the path
+// or name of p itself or of a package p imports, as in io.Reader.
+func lookupIface(p *layout.Package) error {
+	name := *flagIface
+	if p.TypesPackage == nil {
+		return fmt.Errorf("cannot find -iface interface %s: package was not type-checked", name)
+	}
+	var obj types.Object
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		path, base := name[:i], name[i+1:]
+		pkgs := append([]*types.Package{p.TypesPackage}, p.TypesPackage.Imports()...)
+		for _, imp := range pkgs {
+			if imp.Path() == path || imp.Name() == path {
+				obj = imp.Scope().Lookup(base)
+				break
+			}
+		}
+	} else if obj = p.TypesPackage.Scope().Lookup(name); obj == nil {
+		obj = types.Universe.Lookup(name)
+	}
+	tn, ok := obj.(*types.TypeName)
+	if !ok {
+		if strings.Contains(name, ".") {
+			return fmt.Errorf("cannot find -iface interface %s in %s or the packages it imports", name, p.ImportPath)
+		}
+		return fmt.Errorf("cannot find -iface interface %s", name)
+	}
+	it, ok := tn.Type().Underlying().(*types.Interface)
+	if !ok {
+		return fmt.Errorf("-iface type %s is not an interface", name)
+	}
+	if !it.IsMethodSet() {
+		return fmt.Errorf("-iface type %s is a constraint, not an ordinary interface", name)
+	}
+	ifaceType, ifacePkg = it, p.TypesPackage
+	return nil
+}
+
+// An ifaceCost is the cost of storing a value in the -iface interface.
+type ifaceCost struct {
+	Name    string `json:"name"`
+	Pointer bool   `json:"pointer"` // only *T implements the interface
+	Itab    int64  `json:"itab"`
+	Inline  bool   `json:"inline"`
+	Boxed   int64  `json:"boxed"`
+	Total   int64  `json:"total"`
+}
+
+// ifaceCostOf returns the cost of storing a value of type t, or of *t if
+// only that implements it, in the -iface interface. It reports false if
+// neither implements it, t is itself an interface, or t's type is unknown,
+// as for -expr types.
+//
+// The runtime allocates one itab for each pair of interface and concrete
+// type, the first time the pair is used, holding two pointers, a 32-bit hash,
+// and one word per method. An empty interface needs no itab.
+// A pointer-shaped value, such as a pointer, map, or struct holding a single
+// pointer, is stored directly in the interface's data word; any other value
+// is copied into a new allocation, or boxed, each time it is converted.
+func ifaceCostOf(t *layout.Type, ptrSize int64) (ifaceCost, bool) {
+	tn, ok := ifacePkg.Scope().Lookup(t.Name).(*types.TypeName)
+	if !ok || isGenericType(tn) || types.IsInterface(tn.Type()) {
+		return ifaceCost{}, false
+	}
+	c := ifaceCost{Name: *flagIface}
+	typ := tn.Type()
+	if !types.Implements(typ, ifaceType) {
+		if !types.Implements(types.NewPointer(typ), ifaceType) {
+			return ifaceCost{}, false
+		}
+		c.Pointer = true
+	}
+	if n := int64(ifaceType.NumMethods()); n > 0 {
+		c.Itab = (2*ptrSize+4+ptrSize-1)/ptrSize*ptrSize + n*ptrSize
+	}
+	if c.Pointer || pointerShaped(typ) {
+		c.Inline = true
+	} else {
+		c.Boxed = t.Size
+	}
+	c.Total = c.Itab + c.Boxed
+	return c, true
+}
+
+// isGenericType reports whether tn declares a generic type,
+// which has no size until instantiated.
+func isGenericType(tn *types.TypeName) bool {
+	named, ok := tn.Type().(*types.Named)
+	return ok && named.TypeParams().Len() > 0
+}
+
+// pointerShaped reports whether a value of type typ is a single pointer,
+// which the runtime stores directly in an interface.
+func pointerShaped(typ types.Type) bool {
+	switch typ := typ.Underlying().(type) {
+	case *types.Pointer, *types.Map, *types.Chan, *types.Signature:
+		return true
+	case *types.Basic:
+		return typ.Kind() == types.UnsafePointer
+	case *types.Struct:
+		return typ.NumFields() == 1 && pointerShaped(typ.Field(0).Type())
+	case *types.Array:
+		return typ.Len() == 1 && pointerShaped(typ.Elem())
+	}
+	return false
+}
+
+// format returns the text form of c for the type named name,
+// as in T iface Namer itab=32 boxed=24 total=56.
+func (c ifaceCost) format(name string) string {
+	s := name + " iface " + c.Name
+	if c.Pointer {
+		s += " via *" + name
+	}
+	s += " itab=" + fmtInt(c.Itab)
+	if c.Inline {
+		s += " inline"
+	} else {
+		s += " boxed=" + fmtInt(c.Boxed)
+	}
+	return s + " total=" + fmtInt(c.Total)
+}
@@ -0,0 +1,693 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layout
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dir returns the directory of the package named by the import path,
+// or opts.Dir if importPath is empty.
+// The directories are remembered for the life of the program,
+// so that looking up the same package again, as when building it
+// for several architectures, does not run go list again.
+func Dir(importPath string, opts Options) (string, error) {
+	if importPath == "" {
+		if opts.Dir == "" {
+			return ".", nil
+		}
+		return opts.Dir, nil
+	}
+	key := listKey{
+		path:   importPath,
+		dir:    opts.Dir,
+		goos:   opts.getenv("GOOS"),
+		goarch: opts.getenv("GOARCH"),
+		tags:   opts.Tags,
+		mod:    opts.Mod,
+		goCmd:  opts.goCmd(),
+	}
+	listCache.Lock()
+	dir, ok := listCache.m[key]
+	listCache.Unlock()
+	if ok {
+		opts.logf("using cached go list result for %s", importPath)
+		return dir, nil
+	}
+
+	cmd := exec.Command(opts.goCmd(), opts.goArgs("list", "-f", "{{.Dir}}", importPath)...)
+	cmd.Dir = opts.Dir
+	cmd.Env = opts.environ()
+	start := time.Now()
+	out, err := opts.output("go list", cmd)
+	opts.timed("go list", start)
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Clean(strings.TrimSpace(string(out)))
+
+	listCache.Lock()
+	if listCache.m == nil {
+		listCache.m = make(map[listKey]string)
+	}
+	listCache.m[key] = dir
+	listCache.Unlock()
+	return dir, nil
+}
+
+// A listKey identifies a package directory lookup in listCache:
+// the import path, and the settings that can change its result.
+type listKey struct {
+	path   string
+	dir    string
+	goos   string
+	goarch string
+	tags   string
+	mod    string
+	goCmd  string
+}
+
+// listCache holds the package directories found by Dir.
+var listCache struct {
+	sync.Mutex
+	m map[listKey]string
+}
+
+// Expand returns the import paths of the packages matching pattern,
+// such as ./... or std, as listed by "go list."
+// A package that fails to load is still listed, so that
+// the error can be reported when it is built.
+func Expand(pattern string, opts Options) ([]string, error) {
+	if opts.DryRun != nil {
+		return nil, opts.printCommand(opts.goArgs("list", "-e", "-f", "{{.ImportPath}}", pattern))
+	}
+	cmd := exec.Command(opts.goCmd(), opts.goArgs("list", "-e", "-f", "{{.ImportPath}}", pattern)...)
+	cmd.Dir = opts.Dir
+	cmd.Env = opts.environ()
+	out, err := opts.output("go list "+pattern, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// generated is the set of directories in which generate has run go generate.
+var generated struct {
+	sync.Mutex
+	m map[string]bool
+}
+
+// generate runs go generate ./... in dir, unless it has already done so.
+func generate(dir string, opts *Options) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	generated.Lock()
+	done := generated.m[abs]
+	if generated.m == nil {
+		generated.m = make(map[string]bool)
+	}
+	generated.m[abs] = true
+	generated.Unlock()
+	if done {
+		return nil
+	}
+
+	args := opts.goArgs("generate", "./...")
+	opts.logf("go %s (in %s)", strings.Join(args, " "), dir)
+	cmd := exec.Command(opts.goCmd(), args...)
+	cmd.Dir = dir
+	cmd.Env = opts.environ()
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	opts.timed("go generate", start)
+	msg := bytes.TrimSpace(out)
+	if err != nil {
+		if len(msg) > 0 {
+			return fmt.Errorf("go generate failed:\n%s", msg)
+		}
+		return fmt.Errorf("go generate: %v", err)
+	}
+	if len(msg) > 0 {
+		opts.logf("go generate: %s", msg)
+	}
+	return nil
+}
+
+// listFormat is the go list -f template for the information build needs.
+const listFormat = "{{.ImportPath}}\n{{.Stale}}\n{{.SFiles}}\n{{.Name}}\n" +
+	"{{context.GOOS}}\n{{context.GOARCH}}\n{{context.ReleaseTags}}\n{{context.CgoEnabled}}\n" +
+	"{{.GoFiles}} {{.CgoFiles}} {{.SFiles}} {{.HFiles}}\n{{.Dir}}"
+
+// build builds the package in dir and returns the information
+// parsed from its go_asm.h file.
+func build(dir string, opts *Options) (*Package, error) {
+	// Find information about package.
+	cmd := exec.Command(opts.goCmd(), opts.goArgs("list", "-f", listFormat)...)
+	cmd.Dir = dir
+	cmd.Env = opts.environ()
+	start := time.Now()
+	outb, err := opts.output("go list", cmd)
+	opts.timed("go list", start)
+	if err != nil {
+		if strings.Contains(err.Error(), "build constraints exclude all Go files") && !opts.cgoEnabled(dir) {
+			err = fmt.Errorf("%v\n(cgo is disabled, and the package may require it)", err)
+		}
+		return nil, err
+	}
+	lines := splitLines(string(outb))
+	if len(lines) < 10 {
+		return nil, fmt.Errorf("go list: unexpected output")
+	}
+	pkg := lines[0]
+	stale := lines[1] == "true"
+	haveSFiles := lines[2] != "[]"
+	packageName := lines[3]
+
+	p := &Package{
+		ImportPath: pkg,
+		Name:       packageName,
+		Dir:        filepath.Clean(lines[len(lines)-1]),
+		GOOS:       lines[4],
+		GOARCH:     lines[5],
+		Cgo:        lines[7] == "true",
+	}
+	if p.PtrSize, err = ptrSize(p.GOARCH); err != nil {
+		return nil, err
+	}
+	opts.logf("building %s for GOOS=%s GOARCH=%s", pkg, p.GOOS, p.GOARCH)
+	opts.logf("cgo enabled: %v", p.Cgo)
+
+	var goFiles []string
+	for _, file := range strings.Fields(strings.NewReplacer("[", " ", "]", " ").Replace(lines[len(lines)-2])) {
+		if strings.HasSuffix(file, ".go") {
+			goFiles = append(goFiles, file)
+		}
+	}
+	named, generic := namedTypes(p.Dir, goFiles)
+	p.Generic = generic
+
+	// Check the cache.
+	key := ""
+	if !opts.NoCache {
+		key = cacheKey(lines, opts)
+		if data := readCache(key); data != nil {
+			opts.logf("cache hit for %s", pkg)
+			opts.dumpHeader(data)
+			start := time.Now()
+			parseHeader(p, data, opts.Exprs)
+			opts.timed("parse", start)
+			return p, nil
+		}
+		opts.logf("cache miss for %s", pkg)
+	}
+
+	// The stub files written below have names unique to this build
+	// and are included only when building with its build tag,
+	// so that concurrent runs in the same directory, as for different
+	// architectures, neither see nor remove each other's stubs.
+	id := newStubID()
+	tag := "rsc_io_sizeof_" + id
+
+	// Write type declarations for Exprs and for the named types
+	// that the compiler would otherwise leave out of go_asm.h.
+	// Without Exprs, failing to write the stub only loses
+	// the non-struct types, so it is not an error.
+	exprStub := ""
+	if len(opts.Exprs) > 0 || len(named) > 0 {
+		stub := filepath.Join(dir, "xxx_rsc_io_sizeof_expr_"+id+"_.go")
+		opts.logf("writing %v", stub)
+		if err := ioutil.WriteFile(stub, exprSource(packageName, tag, opts.Exprs, named), 0666); err != nil {
+			if len(opts.Exprs) > 0 {
+				return nil, err
+			}
+			opts.logf("write failed: %v", err)
+		} else {
+			exprStub = stub
+			addTemp(stub)
+			defer removeTemp(stub, opts)
+		}
+	}
+
+	// Figure out how to get the asm header file.
+	useWork := haveSFiles
+	switch opts.Strategy {
+	case "":
+	case StrategyWork:
+		useWork = true
+	case StrategyAsmhdr:
+		useWork = false
+	default:
+		return nil, fmt.Errorf("unknown strategy %q", opts.Strategy)
+	}
+	tmp := ""
+	asmhdr := ""
+	bopts := *opts
+	if bopts.Tags != "" {
+		bopts.Tags += ","
+	}
+	bopts.Tags += tag
+	args := bopts.goArgs("build")
+	if useWork {
+		// Go command already writes asmhdr file. Use that one.
+		if haveSFiles {
+			opts.logf("package has .s files; using -work")
+		} else {
+			opts.logf("strategy %s; using -work", opts.Strategy)
+			// The go command writes go_asm.h only for packages
+			// with assembly files, so supply an empty one.
+			stub := filepath.Join(dir, "xxx_rsc_io_sizeof_asm_"+id+"_.s")
+			opts.logf("writing %v", stub)
+			if err := ioutil.WriteFile(stub, []byte(stubHeader(tag)), 0666); err != nil {
+				return nil, err
+			}
+			addTemp(stub)
+			defer removeTemp(stub, opts)
+		}
+		args = append(args, "-work")
+	} else {
+		// Add -asmhdr explicitly.
+		// This is used for every package being built,
+		// but ours is built last and only after all the others,
+		// so the repeated smashing of the file before then
+		// is okay.
+		if !haveSFiles {
+			opts.logf("package has no .s files; using -asmhdr")
+		} else {
+			opts.logf("strategy %s; using -asmhdr", opts.Strategy)
+		}
+		// Close the file right away: on Windows,
+		// the compiler cannot replace a file that is still open.
+		f, err := ioutil.TempFile(opts.TempDir, "rsc-io-sizeof-")
+		if err != nil {
+			return nil, err
+		}
+		tmp = f.Name()
+		f.Close()
+		addTemp(tmp)
+		defer removeTemp(tmp, opts)
+		asmhdr = asmhdrFlag(tmp)
+	}
+	args = append(args, buildFlags(opts.BuildFlags, asmhdr)...)
+	if packageName == "main" {
+		// Building a command would otherwise write
+		// its executable into the package directory.
+		args = append(args, "-o", os.DevNull)
+	}
+
+	// Figure out how to force the build of the package.
+	if !stale {
+		stub := filepath.Join(dir, "xxx_rsc_io_sizeof_tmp_"+id+"_.go")
+		opts.logf("package is not stale; writing %v", stub)
+		// The comment makes the stub differ from the one written
+		// by an earlier run, so that the go build cache cannot satisfy
+		// the build without running the compiler again. Otherwise,
+		// with -work, no go_asm.h would be written.
+		src := fmt.Sprintf("%spackage %s\n\n// %d\n", stubHeader(tag), packageName, time.Now().UnixNano())
+		err := ioutil.WriteFile(stub, []byte(src), 0666)
+		if err != nil {
+			opts.logf("write failed: %v", err)
+			args = append(args, "-a")
+			p.Forced = ForcedAll
+		} else {
+			addTemp(stub)
+			defer removeTemp(stub, opts)
+			p.Forced = ForcedStub
+		}
+	}
+
+	// Build.
+	var out, workdir string
+	for {
+		opts.logf("%sgo %v", strings.Join(append(opts.Env, ""), " "), strings.Join(args, " "))
+		cmd = exec.Command(opts.goCmd(), args...)
+		cmd.Dir = dir
+		cmd.Env = opts.environ()
+		start := time.Now()
+		outb, err = cmd.CombinedOutput()
+		opts.timed("go build", start)
+		out = string(outb)
+		workdir = ""
+		if strings.HasPrefix(out, "WORK=") {
+			i := strings.Index(out, "\n")
+			if i >= 0 {
+				workdir = strings.TrimSpace(out[len("WORK="):i])
+				out = out[i+1:]
+				addTemp(workdir)
+				defer removeTemp(workdir, opts)
+			}
+		}
+		if err == nil || len(named) == 0 || exprStub == "" {
+			break
+		}
+		// One of the named types may not be usable as a struct field,
+		// such as a constraint interface that namedTypes cannot
+		// recognize from the syntax alone. Try again without them.
+		opts.logf("build failed; retrying without non-struct types")
+		named = nil
+		if err := ioutil.WriteFile(exprStub, exprSource(packageName, tag, opts.Exprs, nil), 0666); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		err = opts.goError("go build", []byte(out), err)
+		if p.Cgo && (p.GOOS != runtime.GOOS || p.GOARCH != runtime.GOARCH) && strings.Contains(out, "cgo") {
+			err = fmt.Errorf("%v\n(cgo is enabled for a cross build to %s/%s: set CC to a C cross compiler, or set CGO_ENABLED=0)", err, p.GOOS, p.GOARCH)
+		}
+		return nil, err
+	}
+
+	var data []byte
+	if useWork {
+		if workdir == "" {
+			return nil, fmt.Errorf("go build: cannot find work directory")
+		}
+		// Parse go_asm.h file left in work directory.
+		hdr, err1 := findHeader(workdir, pkg, opts)
+		if err1 != nil {
+			return nil, err1
+		}
+		data, err = ioutil.ReadFile(hdr)
+	} else {
+		// Parse go_asm.h file written to f.
+		data, err = ioutil.ReadFile(tmp)
+		if err == nil && len(data) == 0 {
+			// The compiler always writes a header comment,
+			// so an empty file means -asmhdr was overridden.
+			err = fmt.Errorf("go build: compiler did not write go_asm.h for -asmhdr")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		writeCache(key, data, opts)
+	}
+	opts.dumpHeader(data)
+	start = time.Now()
+	parseHeader(p, data, opts.Exprs)
+	opts.timed("parse", start)
+	return p, nil
+}
+
+// dumpHeader writes the go_asm.h file data to opts.Header, if set.
+func (opts *Options) dumpHeader(data []byte) {
+	if opts.Header != nil {
+		opts.Header.Write(data)
+	}
+}
+
+// splitLines splits the go command output out into lines,
+// ignoring the carriage returns that may end lines on Windows.
+func splitLines(out string) []string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// buildFlags returns the go build flags for the user's flags in list
+// and the compiler flags gcflags needed by Sizes, if any.
+// The go command uses only the last -gcflags that matches a package,
+// so the user's last -gcflags is repeated along with gcflags,
+// limited to the package being measured.
+func buildFlags(list []string, gcflags string) []string {
+	var args []string
+	user := ""
+	for i := 0; i < len(list); i++ {
+		f := list[i]
+		name := strings.TrimPrefix(strings.TrimPrefix(f, "-"), "-")
+		switch {
+		case name == "gcflags" && i+1 < len(list):
+			i++
+			user = list[i]
+		case strings.HasPrefix(name, "gcflags="):
+			user = name[len("gcflags="):]
+		default:
+			args = append(args, f)
+			continue
+		}
+		args = append(args, "-gcflags", user)
+	}
+	if gcflags != "" {
+		// Drop a package pattern, as in all=-N -l.
+		if i := strings.Index(user, "="); i >= 0 && !strings.HasPrefix(user, "-") {
+			user = user[i+1:]
+		}
+		args = append(args, "-gcflags", strings.TrimSpace(user+" "+gcflags))
+	}
+	return args
+}
+
+// asmhdrFlag returns the -gcflags value asking the compiler to write
+// the assembly header to file. The go command splits the value at spaces,
+// but temporary file names on Windows often contain spaces,
+// as in C:\Users\Jane Doe\AppData, so such names are quoted.
+// The value must begin with a dash, so the name is passed as
+// a separate argument instead of quoting the whole flag.
+func asmhdrFlag(file string) string {
+	if !strings.ContainsAny(file, " \t") {
+		return "-asmhdr=" + file
+	}
+	if strings.Contains(file, "'") {
+		return `-asmhdr "` + file + `"`
+	}
+	return "-asmhdr '" + file + "'"
+}
+
+// findHeader returns the name of the go_asm.h file for package pkg
+// in the go build work directory workdir.
+// Old go commands wrote it to $WORK/pkg/_obj/go_asm.h.
+// Newer ones write it to $WORK/b001/go_asm.h, where b001 is the
+// action for the package being built, but other numbered directories may
+// hold headers for dependencies built at the same time. If the expected
+// files are missing, findHeader walks the work directory and uses the
+// most recently written go_asm.h, since the package is built last.
+func findHeader(workdir, pkg string, opts *Options) (string, error) {
+	for _, name := range []string{
+		filepath.Join(workdir, filepath.FromSlash(pkg), "_obj", "go_asm.h"),
+		filepath.Join(workdir, "b001", "go_asm.h"),
+	} {
+		if _, err := os.Stat(name); err == nil {
+			return name, nil
+		}
+	}
+
+	var hdr string
+	var mtime time.Time
+	filepath.Walk(workdir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !fi.IsDir() && fi.Name() == "go_asm.h" && (hdr == "" || fi.ModTime().After(mtime)) {
+			hdr = path
+			mtime = fi.ModTime()
+		}
+		return nil
+	})
+	if hdr == "" {
+		return "", fmt.Errorf("go build: cannot find go_asm.h in %s", workdir)
+	}
+	opts.logf("using %s", hdr)
+	return hdr, nil
+}
+
+// tempFiles is the set of temporary files and directories
+// to remove if the program is interrupted.
+var tempFiles struct {
+	sync.Mutex
+	m map[string]bool
+}
+
+// addTemp records that the file or directory name is temporary.
+func addTemp(name string) {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	if tempFiles.m == nil {
+		tempFiles.m = make(map[string]bool)
+	}
+	tempFiles.m[name] = true
+}
+
+// removeTemp removes the temporary file or directory name.
+func removeTemp(name string, opts *Options) {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	opts.logf("rm %v", name)
+	os.RemoveAll(name)
+	delete(tempFiles.m, name)
+}
+
+// Cleanup removes the temporary files and directories written by
+// builds that are still in progress. A program that exits on an
+// interrupt should call Cleanup first, so that the stub files written
+// into package directories are not left behind. After Cleanup,
+// the in-progress builds fail.
+func Cleanup() {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	for name := range tempFiles.m {
+		os.RemoveAll(name)
+	}
+	tempFiles.m = nil
+}
+
+// stubCount counts the stub IDs returned by newStubID.
+var stubCount struct {
+	sync.Mutex
+	n int
+}
+
+// newStubID returns an ID for the stub files of a build,
+// unique among the programs running on the system.
+func newStubID() string {
+	stubCount.Lock()
+	defer stubCount.Unlock()
+	stubCount.n++
+	return fmt.Sprintf("%d_%d", os.Getpid(), stubCount.n)
+}
+
+// stubHeader returns the build constraint lines
+// beginning a stub file built only with tag.
+func stubHeader(tag string) string {
+	return fmt.Sprintf("//go:build %s\n// +build %s\n\n", tag, tag)
+}
+
+// exprPrefix is the prefix of the names of the
+// struct types that wrap the Exprs type expressions.
+const exprPrefix = "xxx_rsc_io_sizeof_expr_"
+
+// exprSource returns the source for a file in package pkg, built only
+// with the build tag tag, declaring a struct type wrapping each of the
+// type expressions in exprs and each of the named types in named.
+// The compiler only reports the sizes of struct types, but a struct
+// with a single field has the same size as that field.
+func exprSource(pkg, tag string, exprs, named []string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%spackage %s\n", stubHeader(tag), pkg)
+	for i, x := range exprs {
+		fmt.Fprintf(&buf, "\ntype %s%d struct {\n\tx %s\n}\n", exprPrefix, i, x)
+	}
+	for _, name := range named {
+		fmt.Fprintf(&buf, "\ntype %s%s struct {\n\tx %s\n}\n", typePrefix, name, name)
+	}
+	return buf.Bytes()
+}
+
+// goArgs returns the arguments for running the go subcommand verb
+// with the given arguments, adding the build flags from opts.
+// A -tags flag on the command line would replace the one in GOFLAGS,
+// so the tags from GOFLAGS are added to opts.Tags instead.
+func (opts *Options) goArgs(verb string, args ...string) []string {
+	list := []string{verb}
+	if opts.Tags != "" {
+		tags := opts.Tags
+		if t := goflagsTags(opts.getenv("GOFLAGS")); t != "" {
+			tags = t + "," + tags
+		}
+		list = append(list, "-tags="+tags)
+	}
+	if opts.Mod != "" {
+		list = append(list, "-mod="+opts.Mod)
+	}
+	return append(list, args...)
+}
+
+// goflagsTags returns the build tags set by -tags in goflags,
+// a GOFLAGS value, or "" if there are none.
+// As for the go command, the last -tags flag wins.
+func goflagsTags(goflags string) string {
+	tags := ""
+	for _, f := range strings.Fields(goflags) {
+		f = strings.TrimPrefix(strings.TrimPrefix(f, "-"), "-")
+		if strings.HasPrefix(f, "tags=") {
+			tags = f[len("tags="):]
+		}
+	}
+	return tags
+}
+
+// goCmd returns the go command to run.
+func (opts *Options) goCmd() string {
+	if opts.Go == "" {
+		return "go"
+	}
+	return opts.Go
+}
+
+// output runs the go command cmd, described by name, and returns its
+// standard output. Messages printed to standard error, such as warnings
+// about deprecated modules, do not cause a failure: they are reported
+// through Logf if cmd succeeds and in the error if it fails.
+func (opts *Options) output(name string, cmd *exec.Cmd) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, opts.goError(name, stderr.Bytes(), err)
+	}
+	if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+		opts.logf("%s: %s", name, msg)
+	}
+	return out, nil
+}
+
+// cgoEnabled reports whether the go command run in dir has cgo enabled.
+func (opts *Options) cgoEnabled(dir string) bool {
+	cmd := exec.Command(opts.goCmd(), "env", "CGO_ENABLED")
+	cmd.Dir = dir
+	cmd.Env = opts.environ()
+	out, err := cmd.Output()
+	return err == nil && strings.TrimSpace(string(out)) == "1"
+}
+
+// goError returns an error describing the failure of the go command cmd,
+// which printed out and failed with err.
+func (opts *Options) goError(cmd string, out []byte, err error) error {
+	out = bytes.TrimSpace(out)
+	if opts.Mod != "" && bytes.Contains(out, []byte("flag provided but not defined: -mod")) {
+		return fmt.Errorf("%s: -mod requires a go command with module support", cmd)
+	}
+	if len(out) > 0 {
+		return fmt.Errorf("%s", out)
+	}
+	return fmt.Errorf("%s: %v", cmd, err)
+}
+
+// getenv returns the value of the environment variable key
+// for the go command run with opts.
+func (opts *Options) getenv(key string) string {
+	for i := len(opts.Env) - 1; i >= 0; i-- {
+		if strings.HasPrefix(opts.Env[i], key+"=") {
+			return opts.Env[i][len(key)+1:]
+		}
+	}
+	return os.Getenv(key)
+}
+
+// environ returns the environment for running the go command with opts:
+// the program's own environment followed by the additional variables in
+// opts.Env, and GOTMPDIR if opts.TempDir is set, so that the go command's
+// work directory is created there too. A later setting of a variable
+// overrides an earlier one, so opts.Env takes precedence.
+func (opts *Options) environ() []string {
+	env := append([]string(nil), os.Environ()...)
+	env = append(env, opts.Env...)
+	if opts.TempDir != "" {
+		env = append(env, "GOTMPDIR="+opts.TempDir)
+	}
+	return env
+}
@@ -0,0 +1,92 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layout
+
+import (
+	"fmt"
+	"go/types"
+	"os/exec"
+)
+
+// builtins lists the representations of Go's built-in types,
+// as laid out by the runtime, in terms of words.
+// A type with no fields is a single pointer.
+var builtins = []struct {
+	name   string
+	fields []string // int fields; names of pointer fields begin with *
+}{
+	{"pointer", nil},
+	{"string", []string{"*str", "len"}},
+	{"slice", []string{"*array", "len", "cap"}},
+	{"map", nil},
+	{"chan", nil},
+	{"func", nil},
+	{"interface", []string{"*tab", "*data"}},
+	{"eface", []string{"*_type", "*data"}},
+}
+
+// Builtins returns the layout of the headers of Go's built-in types
+// for the target system of the go command, as run with opts:
+// pointer, string, slice, map, chan, func, interface (non-empty),
+// and eface (empty interface). The string, slice, and interface headers
+// have fields named as in the runtime; the others are a single pointer.
+// The returned Package has no import path or constants.
+// Builtins does not build anything, so opts.Dir need not hold a package.
+func Builtins(opts Options) (*Package, error) {
+	if opts.DryRun != nil {
+		return nil, opts.printCommand([]string{"env", "GOOS", "GOARCH"})
+	}
+	cmd := exec.Command(opts.goCmd(), "env", "GOOS", "GOARCH")
+	cmd.Dir = opts.Dir
+	cmd.Env = opts.environ()
+	out, err := opts.output("go env", cmd)
+	if err != nil {
+		return nil, err
+	}
+	lines := splitLines(string(out))
+	if len(lines) != 2 {
+		return nil, fmt.Errorf("go env: unexpected output")
+	}
+	p := &Package{GOOS: lines[0], GOARCH: lines[1]}
+	if p.PtrSize, err = ptrSize(p.GOARCH); err != nil {
+		return nil, err
+	}
+	opts.logf("computing built-in types for GOOS=%s GOARCH=%s", p.GOOS, p.GOARCH)
+
+	sizes := types.SizesFor("gc", p.GOARCH)
+	ptr := types.Typ[types.UnsafePointer]
+	for _, b := range builtins {
+		t := &Type{Name: b.name}
+		if b.fields == nil {
+			t.Size = sizes.Sizeof(ptr)
+			t.Align = sizes.Alignof(ptr)
+			p.Types = append(p.Types, t)
+			continue
+		}
+		var vars []*types.Var
+		for _, f := range b.fields {
+			typ := types.Typ[types.Int]
+			if f[0] == '*' {
+				f = f[1:]
+				typ = ptr
+			}
+			vars = append(vars, types.NewField(0, nil, f, typ, false))
+		}
+		st := types.NewStruct(vars, nil)
+		t.Size = sizes.Sizeof(st)
+		t.Align = sizes.Alignof(st)
+		offsets := sizes.Offsetsof(vars)
+		for i, v := range vars {
+			t.Fields = append(t.Fields, Field{
+				Name:   v.Name(),
+				Offset: offsets[i],
+				Size:   sizes.Sizeof(v.Type()),
+				Type:   v.Type().String(),
+			})
+		}
+		p.Types = append(p.Types, t)
+	}
+	return p, nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layout
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// cacheKey returns the cache key for the go_asm.h file of a package,
+// given the lines printed by go list in build, or "" if there is none.
+// The key covers the package's import path and directory, its source files
+// and their sizes and modification times, the target system, the go command
+// and its Go version, and the options that affect the build.
+// It leaves out whether go list reported the package stale, which depends
+// on the state of the go command's build cache, not on the package.
+func cacheKey(lines []string, opts *Options) string {
+	version, err := opts.goVersion(lines[len(lines)-1])
+	if err != nil {
+		opts.logf("not using cache: %v", err)
+		return ""
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "sizeof cache v3\n")
+	fmt.Fprintf(h, "package %s %s\n", lines[0], lines[3])
+	fmt.Fprintf(h, "target %s %s cgo=%s\n", lines[4], lines[5], lines[7])
+	fmt.Fprintf(h, "release %s\n", lines[6])
+	fmt.Fprintf(h, "go %s %s\n", opts.goCmd(), version)
+	fmt.Fprintf(h, "tags %s\n", opts.Tags)
+	for _, x := range opts.BuildFlags {
+		fmt.Fprintf(h, "build %s\n", x)
+	}
+	for _, x := range opts.Exprs {
+		fmt.Fprintf(h, "expr %s\n", x)
+	}
+
+	// Add the source files, with their sizes and modification times.
+	dir := lines[len(lines)-1]
+	fmt.Fprintf(h, "dir %s\n", dir)
+	files := strings.Fields(strings.NewReplacer("[", " ", "]", " ").Replace(lines[len(lines)-2]))
+	for _, file := range files {
+		fi, err := os.Stat(filepath.Join(dir, file))
+		if err != nil {
+			return ""
+		}
+		fmt.Fprintf(h, "file %s %d %d\n", file, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// goVersions caches the results of goVersion.
+var goVersions struct {
+	sync.Mutex
+	m map[string]string
+}
+
+// goVersion returns the version of the Go toolchain that the go command
+// uses in dir, such as go1.22.1, which a go.mod toolchain line can select.
+func (opts *Options) goVersion(dir string) (string, error) {
+	key := opts.goCmd() + "\x00" + dir + "\x00" + strings.Join(opts.Env, "\x00")
+	goVersions.Lock()
+	defer goVersions.Unlock()
+	if v, ok := goVersions.m[key]; ok {
+		return v, nil
+	}
+	cmd := exec.Command(opts.goCmd(), "env", "GOVERSION")
+	cmd.Dir = dir
+	cmd.Env = opts.environ()
+	out, err := opts.output("go env", cmd)
+	if err != nil {
+		return "", err
+	}
+	if goVersions.m == nil {
+		goVersions.m = make(map[string]string)
+	}
+	v := strings.TrimSpace(string(out))
+	goVersions.m[key] = v
+	return v, nil
+}
+
+// cacheDir returns the directory holding cached go_asm.h files.
+func cacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "rsc.io-sizeof"), nil
+}
+
+// readCache returns the cached go_asm.h file for key,
+// or nil if there is none.
+func readCache(key string) []byte {
+	if key == "" {
+		return nil
+	}
+	dir, err := cacheDir()
+	if err != nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, key))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// writeCache records data as the go_asm.h file for key.
+// Errors are not fatal: the cache is only an optimization.
+func writeCache(key string, data []byte, opts *Options) {
+	dir, err := cacheDir()
+	if err == nil {
+		err = os.MkdirAll(dir, 0777)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, key), data, 0666)
+	}
+	if err != nil {
+		opts.logf("writing cache: %v", err)
+	}
+}
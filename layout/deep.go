@@ -0,0 +1,74 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layout
+
+import "go/types"
+
+// DeepSize returns an estimate of the memory referenced by a value of type t
+// but allocated separately from it, such as the array behind a slice field.
+// The actual amount depends on the data, so DeepSize uses a simple model,
+// in which every pointer, slice, map, and string is populated:
+//
+//   - a pointer *T points to one T;
+//   - a slice []T holds n elements;
+//   - a map[K]V holds n keys and values, ignoring the hash table overhead;
+//   - a string holds n bytes;
+//   - channels, functions, and interfaces refer to nothing.
+//
+// The estimate includes the memory referenced by those values in turn,
+// except that a type referring back to itself, as in a linked list,
+// is expanded only once along any path.
+// DeepSize reports false if t's type is unknown.
+func (t *Type) DeepSize(n int64) (int64, bool) {
+	if t.Obj == nil {
+		return 0, false
+	}
+	d := &deepSizer{n: n, sizes: t.sizes, seen: map[types.Type]bool{t.Obj.Type(): true}}
+	return d.indirect(t.Obj.Type()), true
+}
+
+// A deepSizer computes the DeepSize of types.
+type deepSizer struct {
+	n     int64
+	sizes types.Sizes
+	seen  map[types.Type]bool // types being expanded
+}
+
+// indirect returns the memory referenced by a value of type typ.
+func (d *deepSizer) indirect(typ types.Type) int64 {
+	switch typ := typ.Underlying().(type) {
+	case *types.Basic:
+		if typ.Kind() == types.String {
+			return d.n
+		}
+	case *types.Pointer:
+		return d.deep(typ.Elem())
+	case *types.Slice:
+		return d.n * d.deep(typ.Elem())
+	case *types.Map:
+		return d.n * (d.deep(typ.Key()) + d.deep(typ.Elem()))
+	case *types.Array:
+		return typ.Len() * d.indirect(typ.Elem())
+	case *types.Struct:
+		total := int64(0)
+		for i := 0; i < typ.NumFields(); i++ {
+			total += d.indirect(typ.Field(i).Type())
+		}
+		return total
+	}
+	return 0
+}
+
+// deep returns the size of a separately allocated value of type typ,
+// including the memory it references.
+func (d *deepSizer) deep(typ types.Type) int64 {
+	size := d.sizes.Sizeof(typ)
+	if d.seen[typ] {
+		return size
+	}
+	d.seen[typ] = true
+	defer delete(d.seen, typ)
+	return size + d.indirect(typ)
+}
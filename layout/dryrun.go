@@ -0,0 +1,141 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layout
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ErrDryRun is returned by Sizes, Expand, and Builtins when
+// Options.DryRun is set, after they print the commands they would run.
+var ErrDryRun = errors.New("dry run: commands not run")
+
+// dryRun prints to opts.DryRun the commands that Sizes would run
+// for the package named by importPath, in the order it would run them,
+// in a subshell so that
+// its change of directory does not affect the next package's.
+// The names of the temporary files are not known until they are
+// created, so the script refers to the go_asm.h file as $ASMHDR.
+func dryRun(importPath string, opts *Options) error {
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(&b, "\t"+format+"\n", args...)
+	}
+	name := importPath
+	if name == "" {
+		name = "."
+	}
+	fmt.Fprintf(&b, "# %s\n(\n", name)
+	if importPath != "" {
+		line("DIR=$(%s)", opts.commandLine(opts.goArgs("list", "-f", "{{.Dir}}", importPath)))
+		line(`cd "$DIR"`)
+	} else if opts.Dir != "" {
+		line("cd %s", shellQuote(opts.Dir))
+	}
+	if opts.Generate {
+		line("%s", opts.commandLine(opts.goArgs("generate", "./...")))
+	}
+	line("%s", opts.commandLine(opts.goArgs("list", "-f", listFormat)))
+	if !opts.NoCache {
+		line("# the Go version is part of the cache key;")
+		line("# go build is skipped if the cache holds the results")
+		line("%s", opts.commandLine([]string{"env", "GOVERSION"}))
+	}
+
+	id := newStubID()
+	tag := "rsc_io_sizeof_" + id
+	bopts := *opts
+	if bopts.Tags != "" {
+		bopts.Tags += ","
+	}
+	bopts.Tags += tag
+	args := bopts.goArgs("build")
+	asmhdr := ""
+	switch opts.Strategy {
+	case "", StrategyAsmhdr:
+		asmhdr = asmhdrFlag("$ASMHDR")
+		tmp := "a temporary file"
+		if opts.TempDir != "" {
+			tmp += " in " + opts.TempDir
+		}
+		line("# ASMHDR is %s", tmp)
+		if opts.Strategy == "" {
+			line("# (go build uses -work instead if the package has .s files)")
+		}
+	case StrategyWork:
+		line("# write xxx_rsc_io_sizeof_asm_%s_.s if the package has no .s files", id)
+		args = append(args, "-work")
+	default:
+		return fmt.Errorf("unknown strategy %q", opts.Strategy)
+	}
+	args = append(args, buildFlags(opts.BuildFlags, asmhdr)...)
+	line("# write xxx_rsc_io_sizeof_expr_%s_.go for -expr and non-struct types", id)
+	line("# write xxx_rsc_io_sizeof_tmp_%s_.go, or else add -a, to force the build", id)
+	line("# (go build also gets -o %s for package main)", os.DevNull)
+	line("%s", opts.commandLine(args))
+	if opts.TypeCheck {
+		line("%s", opts.commandLine(opts.goArgs("list", "-json", "-deps", "-export")))
+	}
+	fmt.Fprintf(&b, ")\n")
+
+	if _, err := fmt.Fprint(opts.DryRun, b.String()); err != nil {
+		return err
+	}
+	return ErrDryRun
+}
+
+// printCommand prints to opts.DryRun the go command with the given
+// arguments, in opts.Dir, and returns ErrDryRun.
+func (opts *Options) printCommand(args []string) error {
+	cmd := opts.commandLine(args)
+	if opts.Dir != "" {
+		cmd = "(cd " + shellQuote(opts.Dir) + " && " + cmd + ")"
+	}
+	if _, err := fmt.Fprintln(opts.DryRun, cmd); err != nil {
+		return err
+	}
+	return ErrDryRun
+}
+
+// commandLine returns the shell command line running the go command
+// with the given arguments, preceded by the environment variables
+// that opts sets for it.
+func (opts *Options) commandLine(args []string) string {
+	var list []string
+	env := opts.Env
+	if opts.TempDir != "" {
+		env = append(env[:len(env):len(env)], "GOTMPDIR="+opts.TempDir)
+	}
+	for _, kv := range env {
+		if i := strings.Index(kv, "="); i >= 0 {
+			list = append(list, kv[:i+1]+shellQuote(kv[i+1:]))
+		}
+	}
+	list = append(list, shellQuote(opts.goCmd()))
+	for _, arg := range args {
+		if strings.Contains(arg, "$ASMHDR") {
+			// Leave the variable to be expanded.
+			list = append(list, `"`+arg+`"`)
+			continue
+		}
+		list = append(list, shellQuote(arg))
+	}
+	return strings.Join(list, " ")
+}
+
+// shellSafe matches the strings that need no quoting in a shell command.
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_./:,+=@%-]+$`)
+
+// shellQuote returns s quoted for use as a single shell word.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,98 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layout
+
+import "go/types"
+
+// EmbeddedFields returns the fields of t, each embedded struct field
+// followed by the fields promoted from it, named by their full path,
+// as in Inner.field, with offsets relative to the start of t.
+// The promotion continues through embedded structs within embedded structs.
+// Fields reached through an embedded pointer are not part of t's layout
+// and are not included.
+// If t's field sizes are unknown, EmbeddedFields returns t.Fields.
+func (t *Type) EmbeddedFields() []Field {
+	if !t.known {
+		return t.Fields
+	}
+	st := t.Obj.Type().Underlying().(*types.Struct)
+	vars := structFields(st)
+	offsets := t.sizes.Offsetsof(vars)
+	byName := make(map[string]int)
+	for i, v := range vars {
+		byName[v.Name()] = i
+	}
+	qual := qualifier(t.Obj.Pkg())
+	var list []Field
+	for _, f := range t.Fields {
+		list = append(list, f)
+		if i, ok := byName[f.Name]; ok && vars[i].Embedded() {
+			list = t.appendPromoted(list, f.Name+".", vars[i].Type(), offsets[i], qual)
+		}
+	}
+	return list
+}
+
+// appendPromoted appends to list the fields of the embedded field
+// of type typ at offset off, with names beginning with prefix.
+func (t *Type) appendPromoted(list []Field, prefix string, typ types.Type, off int64, qual types.Qualifier) []Field {
+	st, ok := typ.Underlying().(*types.Struct)
+	if !ok {
+		return list
+	}
+	vars := structFields(st)
+	offsets := t.sizes.Offsetsof(vars)
+	for i, v := range vars {
+		if v.Name() == "_" {
+			continue
+		}
+		list = append(list, Field{
+			Name:   prefix + v.Name(),
+			Offset: off + offsets[i],
+			Size:   t.sizes.Sizeof(v.Type()),
+			Type:   types.TypeString(v.Type(), qual),
+		})
+		if v.Embedded() {
+			list = t.appendPromoted(list, prefix+v.Name()+".", v.Type(), off+offsets[i], qual)
+		}
+	}
+	return list
+}
+
+// FlatFields returns the leaf fields of t: the fields whose types are
+// not structs, found by descending into every struct-typed field,
+// embedded or not, at any depth. Each is named by its full path,
+// as in Inner.field, with its offset relative to the start of t,
+// and the list is sorted by offset. Blank fields are omitted.
+// If t's field sizes are unknown, FlatFields returns t.Fields.
+func (t *Type) FlatFields() []Field {
+	if !t.known {
+		return t.Fields
+	}
+	return t.appendLeaves(nil, "", t.Obj.Type().Underlying().(*types.Struct), 0, qualifier(t.Obj.Pkg()))
+}
+
+// appendLeaves appends to list the leaf fields of the struct st
+// at offset off, with names beginning with prefix.
+func (t *Type) appendLeaves(list []Field, prefix string, st *types.Struct, off int64, qual types.Qualifier) []Field {
+	vars := structFields(st)
+	offsets := t.sizes.Offsetsof(vars)
+	for i, v := range vars {
+		if v.Name() == "_" {
+			continue
+		}
+		if inner, ok := v.Type().Underlying().(*types.Struct); ok && inner.NumFields() > 0 {
+			list = t.appendLeaves(list, prefix+v.Name()+".", inner, off+offsets[i], qual)
+			continue
+		}
+		list = append(list, Field{
+			Name:   prefix + v.Name(),
+			Offset: off + offsets[i],
+			Size:   t.sizes.Sizeof(v.Type()),
+			Type:   types.TypeString(v.Type(), qual),
+		})
+	}
+	return list
+}
@@ -0,0 +1,97 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layout
+
+import "go/types"
+
+// A Node is a named type in the graph of types reachable from a Type.
+// The graph may have cycles.
+type Node struct {
+	Name string
+	Size int64
+	Refs []Ref
+}
+
+// A Ref is a reference from a type to a named type used by one of its fields,
+// either directly or as part of a pointer, slice, array, map, or channel type,
+// or a field of an unnamed struct type.
+type Ref struct {
+	Field string // as in next, or a.b for a field of an unnamed struct
+	To    *Node
+}
+
+// Graph returns the root of the graph of named types reachable from t
+// through the types of its fields, and theirs in turn. The graph has one
+// Node for each distinct type; a type referring back to itself, as in
+// a linked list, makes a cycle. Names are qualified by import path,
+// as in internal/sync.Mutex, except for the types in t's package. Predeclared types such as int
+// and error are omitted.
+// Graph returns nil if t's type is unknown.
+func (t *Type) Graph() *Node {
+	if t.Obj == nil {
+		return nil
+	}
+	pkg := t.Obj.Pkg()
+	qual := func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+		return p.Path()
+	}
+	g := &grapher{sizes: t.sizes, qual: qual, nodes: make(map[string]*Node)}
+	root := &Node{Name: t.Name, Size: t.Size}
+	g.nodes[types.TypeString(t.Obj.Type(), g.qual)] = root
+	g.refs(root, "", t.Obj.Type().Underlying())
+	return root
+}
+
+// A grapher builds the graph returned by Type.Graph.
+type grapher struct {
+	sizes types.Sizes
+	qual  types.Qualifier
+	nodes map[string]*Node // by type name
+}
+
+// node returns the node for the named type typ.
+func (g *grapher) node(typ *types.Named) *Node {
+	name := types.TypeString(typ, g.qual)
+	if n := g.nodes[name]; n != nil {
+		return n
+	}
+	n := &Node{Name: name, Size: g.sizes.Sizeof(typ)}
+	g.nodes[name] = n
+	g.refs(n, "", typ.Underlying())
+	return n
+}
+
+// refs adds to n the references to named types made by
+// typ, the type of n's field named field.
+func (g *grapher) refs(n *Node, field string, typ types.Type) {
+	switch typ := types.Unalias(typ).(type) {
+	case *types.Named:
+		if typ.Obj().Pkg() != nil {
+			n.Refs = append(n.Refs, Ref{Field: field, To: g.node(typ)})
+		}
+	case *types.Pointer:
+		g.refs(n, field, typ.Elem())
+	case *types.Slice:
+		g.refs(n, field, typ.Elem())
+	case *types.Array:
+		g.refs(n, field, typ.Elem())
+	case *types.Chan:
+		g.refs(n, field, typ.Elem())
+	case *types.Map:
+		g.refs(n, field, typ.Key())
+		g.refs(n, field, typ.Elem())
+	case *types.Struct:
+		for _, v := range structFields(typ) {
+			name := v.Name()
+			if field != "" {
+				name = field + "." + name
+			}
+			g.refs(n, name, v.Type())
+		}
+	}
+}
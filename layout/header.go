@@ -0,0 +1,73 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layout
+
+import (
+	"strconv"
+	"strings"
+)
+
+// parseHeader parses the #define lines in the go_asm.h file data into p.
+// Types and constants are recorded in the order they appear.
+// The types wrapping the expressions in exprs are renamed to match,
+// as are the types wrapping the package's non-struct named types.
+func parseHeader(p *Package, data []byte, exprs []string) {
+	var t *Type
+	wrapped := make(map[*Type]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		f := strings.Fields(line)
+		if len(f) != 3 || f[0] != "#define" {
+			continue
+		}
+		sym, val := f[1], f[2]
+		if strings.HasPrefix(sym, "const_") {
+			p.Consts = append(p.Consts, &Const{Name: strings.TrimPrefix(sym, "const_"), Value: val})
+			continue
+		}
+		n, err := strconv.ParseInt(val, 0, 64)
+		if err != nil {
+			continue
+		}
+		if strings.HasSuffix(sym, "__size") {
+			t = &Type{Name: strings.TrimSuffix(sym, "__size"), Size: n, Symbol: sym}
+			p.Types = append(p.Types, t)
+			if strings.HasPrefix(t.Name, exprPrefix) {
+				i, err := strconv.Atoi(strings.TrimPrefix(t.Name, exprPrefix))
+				if err == nil && i < len(exprs) {
+					t.Expr = exprs[i]
+				}
+			}
+			if strings.HasPrefix(t.Name, typePrefix) {
+				wrapped[t] = true
+			}
+			continue
+		}
+		if t != nil && t.Expr == "" && !wrapped[t] && strings.HasPrefix(sym, t.Name+"_") {
+			t.Fields = append(t.Fields, Field{Name: sym[len(t.Name)+1:], Offset: n, Symbol: sym})
+		}
+	}
+	// A wrapped type may also have been reported directly,
+	// as in type T U where U is a struct type: keep that one.
+	have := make(map[string]bool)
+	for _, t := range p.Types {
+		if !wrapped[t] {
+			have[t.Name] = true
+		}
+	}
+	list := p.Types[:0]
+	for _, t := range p.Types {
+		if t.Expr != "" {
+			t.Name = t.Expr
+		}
+		if wrapped[t] {
+			t.Name = strings.TrimPrefix(t.Name, typePrefix)
+			if have[t.Name] {
+				continue
+			}
+		}
+		list = append(list, t)
+	}
+	p.Types = list
+}
@@ -0,0 +1,508 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package layout reports the memory layout of the named Go types in a package,
+// as computed by the gc compiler.
+//
+// Layout builds the package using "go build," asking the compiler to write
+// the go_asm.h header that assembly files use to refer to Go data structures,
+// and reads the type sizes, field offsets, and constant values from that header.
+// The header does not record field sizes or alignments, so layout can also
+// type-check the package to fill in that information.
+//
+// The sizeof command (rsc.io/sizeof) is a thin wrapper around this package.
+package layout
+
+import (
+	"fmt"
+	"go/types"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Options controls how Sizes builds and inspects a package.
+type Options struct {
+	// Dir is the directory in which to run the go command.
+	// If Dir is empty, the current directory is used.
+	Dir string
+
+	// Env lists additional environment variables for the go command,
+	// such as GOARCH=386. They are added to the program's environment,
+	// overriding any settings there; later entries override earlier ones.
+	Env []string
+
+	// Go is the go command to run, such as go1.21.0 or /usr/local/go/bin/go.
+	// If empty, Sizes runs go, found in the PATH.
+	Go string
+
+	// Tags is a comma-separated list of build tags.
+	// They are added to any tags set by -tags in GOFLAGS.
+	Tags string
+
+	// Mod is the module download mode passed to the go command's -mod flag:
+	// mod, readonly, or vendor. If empty, the go command's default is used.
+	Mod string
+
+	// BuildFlags lists additional flags for go build, such as -race.
+	// If they include -gcflags, the compiler flags are passed along
+	// with the ones Sizes needs to obtain go_asm.h.
+	BuildFlags []string
+
+	// Exprs lists type expressions, such as [16]byte, to measure in
+	// the context of the package. Each is reported as a Type with Expr set.
+	Exprs []string
+
+	// Generate asks Sizes to run go generate ./... in the package
+	// directory before building, so that generated types are measured.
+	// Sizes runs it at most once for each directory during the life of the
+	// program, however many times the package is measured.
+	Generate bool
+
+	// TypeCheck asks Sizes to type-check the package, filling in
+	// the alignments, field sizes, and field types missing from go_asm.h.
+	TypeCheck bool
+
+	// NoCache disables the cache of build results.
+	NoCache bool
+
+	// TempDir is the directory for temporary files, including the
+	// go command's work directory, which must already exist.
+	// If empty, the system's default directory for temporary files is used.
+	TempDir string
+
+	// Strategy selects how Sizes obtains go_asm.h from the build.
+	// If empty, Sizes uses StrategyWork for packages with assembly files
+	// and StrategyAsmhdr for the rest.
+	Strategy Strategy
+
+	// DryRun, if not nil, receives the go commands that Sizes, Expand,
+	// and Builtins would run, written as a shell script, instead of
+	// running them. They then return ErrDryRun. Commands whose arguments
+	// depend on the output of an earlier one are printed as for a package
+	// without assembly files that must be rebuilt.
+	DryRun io.Writer
+
+	// Header, if not nil, receives a copy of the go_asm.h file,
+	// or of its cached copy, before Sizes parses it.
+	Header io.Writer
+
+	// Logf, if not nil, is called to report details of operation.
+	Logf func(format string, args ...interface{})
+
+	// Timef, if not nil, is called with the time taken by each phase
+	// of the work: "go list", "go generate", "go build", "parse",
+	// and "type-check".
+	// A phase may be reported more than once.
+	Timef func(phase string, d time.Duration)
+}
+
+func (opts *Options) logf(format string, args ...interface{}) {
+	if opts.Logf != nil {
+		opts.Logf(format, args...)
+	}
+}
+
+// timed reports to opts.Timef the time since start taken by phase.
+func (opts *Options) timed(phase string, start time.Time) {
+	if opts.Timef != nil {
+		opts.Timef(phase, time.Since(start))
+	}
+}
+
+// A Package holds the layout information for a single package.
+type Package struct {
+	ImportPath string   `json:"importPath"`
+	Name       string   `json:"name"`
+	Dir        string   `json:"dir"`
+	GOOS       string   `json:"goos"`
+	GOARCH     string   `json:"goarch"`
+	PtrSize    int64    `json:"ptrSize"` // size of a pointer on GOARCH
+	Cgo        bool     `json:"cgo"`     // whether the package was built with cgo enabled
+	Types      []*Type  `json:"types"`
+	Consts     []*Const `json:"consts"`
+
+	// Forced reports whether and how Sizes forced the compilation
+	// of a package that was not stale, since otherwise the go command
+	// would not run the compiler and go_asm.h would not be written.
+	Forced Forced `json:"forced,omitempty"`
+
+	// Generic lists the names of the package's generic types, which have
+	// no size until instantiated. To measure one, list an instantiation,
+	// such as List[int], in Options.Exprs.
+	Generic []string `json:"generic,omitempty"`
+
+	// Interfaces lists the package's named interface types,
+	// which go_asm.h omits. It is set only if Options.TypeCheck was set.
+	Interfaces []*Interface `json:"interfaces,omitempty"`
+
+	// TypesPackage and TypesSizes are the type-checked package and the
+	// sizes for GOARCH. They are set only if Options.TypeCheck was set.
+	TypesPackage *types.Package `json:"-"`
+	TypesSizes   types.Sizes    `json:"-"`
+}
+
+// A Type describes the layout of a single struct type.
+type Type struct {
+	Name   string  `json:"name"`
+	Size   int64   `json:"size"`
+	Align  int64   `json:"align,omitempty"` // set only if type-checked
+	Fields []Field `json:"fields,omitempty"`
+
+	// Expr is the type expression from Options.Exprs that this type measures.
+	// For such types, Name is also the expression.
+	Expr string `json:"expr,omitempty"`
+
+	// Symbol is the go_asm.h symbol giving the size, as in Regexp__size.
+	// For an expression or a wrapped non-struct type, it names the
+	// wrapper struct type that Sizes declared.
+	Symbol string `json:"-"`
+
+	// Obj is the type-checked declaration of the type. It is set for
+	// every named type if the package was type-checked; FieldSizes reports
+	// whether the declaration also matches the layout in go_asm.h.
+	Obj *types.TypeName `json:"-"`
+
+	sizes types.Sizes // sizes used for Obj
+	blank []Field     // blank (_) fields, omitted from go_asm.h
+	under types.Type  // underlying type, if type-checked
+	known bool        // field sizes and types known; see FieldSizes
+}
+
+// An Interface describes a named interface type.
+// Every interface value is two words, whatever its methods:
+// a type or itab pointer and a data pointer. The Methods count
+// gives the size of the method table in the itab for a value
+// stored in the interface. Empty interfaces (Methods == 0)
+// store a type pointer instead of an itab pointer.
+type Interface struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Methods int    `json:"methods"`
+}
+
+// A Field describes a single field of a struct type.
+// Size and Type are set only if the package was type-checked.
+type Field struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Type   string `json:"type,omitempty"`
+
+	// Symbol is the go_asm.h symbol giving the offset, as in Regexp_prog.
+	// It is empty for blank fields, which go_asm.h omits.
+	Symbol string `json:"-"`
+}
+
+// A Const describes a single constant.
+// Value is the constant's value as written in go_asm.h:
+// an integer, true or false, or a Go-quoted string.
+// If the package was type-checked, Consts also includes the constants
+// that go_asm.h cannot represent, with floating-point values such as 3.14159
+// and complex values such as (1+2i).
+type Const struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Sizes builds the package named by importPath, or the package in opts.Dir
+// if importPath is empty, and returns the layout of its types.
+func Sizes(importPath string, opts Options) (*Package, error) {
+	if opts.DryRun != nil {
+		return nil, dryRun(importPath, &opts)
+	}
+	dir, err := Dir(importPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Generate {
+		if err := generate(dir, &opts); err != nil {
+			return nil, err
+		}
+	}
+	p, err := build(dir, &opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.TypeCheck {
+		if err := typeCheck(p, &opts); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// A Forced value describes how Sizes forced the compilation of a package.
+type Forced string
+
+const (
+	// ForcedStub means that Sizes added a temporary source file to the
+	// package, so that only the package itself was recompiled.
+	ForcedStub Forced = "stub"
+
+	// ForcedAll means that Sizes could not add the temporary source file
+	// and ran go build -a, which rebuilds every dependency as well.
+	ForcedAll Forced = "all"
+)
+
+// A Strategy is a way to obtain a package's go_asm.h file from go build.
+type Strategy string
+
+const (
+	// StrategyAsmhdr passes -asmhdr to the compiler, naming a temporary file.
+	// The go command overrides it for packages with assembly files,
+	// which need a go_asm.h of their own.
+	StrategyAsmhdr Strategy = "asmhdr"
+
+	// StrategyWork runs go build -work and reads the go_asm.h file
+	// left in the work directory. The go command writes one only
+	// for packages with assembly files, so for other packages Sizes
+	// adds an empty assembly file, built only for the occasion.
+	StrategyWork Strategy = "work"
+)
+
+// Lookup returns the type with the given name, or nil if there is none.
+func (p *Package) Lookup(name string) *Type {
+	for _, t := range p.Types {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// FieldSizes reports whether the sizes and types of t's fields are known:
+// whether t is a struct type whose type-checked declaration matches
+// its layout in go_asm.h.
+func (t *Type) FieldSizes() bool {
+	return t.known
+}
+
+// AllFields returns all the fields of t, including the blank fields
+// omitted from go_asm.h, sorted by offset. It returns nil if t's field
+// sizes are unknown.
+func (t *Type) AllFields() []Field {
+	if !t.known {
+		return nil
+	}
+	fields := append(append([]Field(nil), t.Fields...), t.blank...)
+	sort.SliceStable(fields, func(i, j int) bool {
+		return fields[i].Offset < fields[j].Offset
+	})
+	return fields
+}
+
+// A Pad describes a run of padding bytes in a struct.
+type Pad struct {
+	Offset int64
+	Size   int64
+}
+
+// Padding returns the padding in t's layout: the gaps between
+// consecutive fields and the tail padding after the last field.
+// It returns nil if t's field sizes are unknown.
+func (t *Type) Padding() []Pad {
+	var pad []Pad
+	end := int64(0)
+	for _, f := range t.AllFields() {
+		if f.Offset > end {
+			pad = append(pad, Pad{end, f.Offset - end})
+		}
+		if e := f.Offset + f.Size; e > end {
+			end = e
+		}
+	}
+	if t.known && t.Size > end {
+		pad = append(pad, Pad{end, t.Size - end})
+	}
+	return pad
+}
+
+// Kind returns the kind of t's underlying type: struct, array, slice, map,
+// chan, func, pointer, interface, or basic, for types such as
+// type Celsius float64. Unlike most information about fields, the kind
+// is known for every type in a type-checked package, not only structs.
+// Kind returns "" if t's type is unknown.
+func (t *Type) Kind() string {
+	switch t.under.(type) {
+	case *types.Struct:
+		return "struct"
+	case *types.Array:
+		return "array"
+	case *types.Slice:
+		return "slice"
+	case *types.Map:
+		return "map"
+	case *types.Chan:
+		return "chan"
+	case *types.Signature:
+		return "func"
+	case *types.Pointer:
+		return "pointer"
+	case *types.Interface:
+		return "interface"
+	case *types.Basic:
+		return "basic"
+	}
+	return ""
+}
+
+// TailPad returns the number of padding bytes after the end of
+// t's last field, which round its size up to a multiple of its alignment.
+// TailPad reports false if t is not a struct type or its field sizes
+// are unknown.
+func (t *Type) TailPad() (int64, bool) {
+	if !t.known {
+		return 0, false
+	}
+	end := int64(0)
+	for _, f := range t.AllFields() {
+		if e := f.Offset + f.Size; e > end {
+			end = e
+		}
+	}
+	return t.Size - end, true
+}
+
+// Array reports whether the field of t with the given name is an array,
+// and if so returns its dimensions, outermost first, and the size of its
+// elements: for a field of type [3][4]int32, Array returns [3 4] and 4.
+// The name may be the path of a promoted field, as in Inner.buf.
+// Array reports false if t's field types are unknown.
+func (t *Type) Array(name string) (dims []int64, elem int64, ok bool) {
+	if t.Obj == nil {
+		return nil, 0, false
+	}
+	typ := t.Obj.Type()
+	for _, elem := range strings.Split(name, ".") {
+		st, ok := typ.Underlying().(*types.Struct)
+		if !ok {
+			return nil, 0, false
+		}
+		var next types.Type
+		for _, v := range structFields(st) {
+			if v.Name() == elem {
+				next = v.Type()
+				break
+			}
+		}
+		if next == nil {
+			return nil, 0, false
+		}
+		typ = next
+	}
+	for {
+		a, ok := typ.Underlying().(*types.Array)
+		if !ok {
+			break
+		}
+		dims = append(dims, a.Len())
+		typ = a.Elem()
+	}
+	if dims == nil {
+		return nil, 0, false
+	}
+	return dims, t.sizes.Sizeof(typ), true
+}
+
+// A Method is a method declared on a type.
+type Method struct {
+	Name    string `json:"name"`
+	Pointer bool   `json:"pointer"` // pointer receiver; otherwise the receiver is copied
+}
+
+// Methods returns the methods declared with t as their receiver, in the order
+// they are declared, omitting the methods promoted from embedded fields.
+// A method with a value receiver copies t.Size bytes on each call.
+// Methods returns nil if t's methods are unknown.
+func (t *Type) Methods() []Method {
+	if t.Obj == nil {
+		return nil
+	}
+	named, ok := t.Obj.Type().(*types.Named)
+	if !ok {
+		return nil
+	}
+	var list []Method
+	for i := 0; i < named.NumMethods(); i++ {
+		m := named.Method(i)
+		_, ptr := m.Type().(*types.Signature).Recv().Type().(*types.Pointer)
+		list = append(list, Method{m.Name(), ptr})
+	}
+	return list
+}
+
+// A Misalign describes a field whose offset is not a multiple of its natural alignment.
+type Misalign struct {
+	Field Field
+	Align int64 // natural alignment
+	By    int64 // offset modulo Align
+}
+
+// Misaligned returns the fields of t whose offsets in go_asm.h are not
+// multiples of their natural alignment, the alignment of their types for
+// the target architecture. It returns nil if t's type is unknown.
+// Fields not found in t's declaration are skipped.
+func (t *Type) Misaligned() []Misalign {
+	if t.Obj == nil {
+		return nil
+	}
+	st, ok := t.Obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		return nil
+	}
+	byName := make(map[string]*types.Var)
+	for i := 0; i < st.NumFields(); i++ {
+		byName[st.Field(i).Name()] = st.Field(i)
+	}
+	var list []Misalign
+	for _, f := range t.Fields {
+		v := byName[f.Name]
+		if v == nil {
+			continue
+		}
+		align := t.sizes.Alignof(v.Type())
+		if by := f.Offset % align; by != 0 {
+			list = append(list, Misalign{f, align, by})
+		}
+	}
+	return list
+}
+
+// Reorder returns the fields of t rearranged to minimize the size of t,
+// along with the resulting size. Zero-size fields come first, followed by
+// the rest in order of decreasing alignment. Fields with equal alignment
+// keep their original relative order. It returns nil if t's field sizes
+// are unknown.
+func (t *Type) Reorder() ([]Field, int64) {
+	if !t.known {
+		return nil, 0
+	}
+	st := t.Obj.Type().Underlying().(*types.Struct)
+	fields := structFields(st)
+	sort.SliceStable(fields, func(i, j int) bool {
+		zi := t.sizes.Sizeof(fields[i].Type()) == 0
+		zj := t.sizes.Sizeof(fields[j].Type()) == 0
+		if zi != zj {
+			return zi
+		}
+		return t.sizes.Alignof(fields[i].Type()) > t.sizes.Alignof(fields[j].Type())
+	})
+	offsets := t.sizes.Offsetsof(fields)
+	var list []Field
+	for i, v := range fields {
+		list = append(list, Field{Name: v.Name(), Offset: offsets[i], Size: t.sizes.Sizeof(v.Type())})
+	}
+	return list, t.sizes.Sizeof(types.NewStruct(fields, nil))
+}
+
+// ptrSize returns the size of a pointer on goarch.
+func ptrSize(goarch string) (int64, error) {
+	sizes := types.SizesFor("gc", goarch)
+	if sizes == nil {
+		return 0, fmt.Errorf("unknown architecture %s", goarch)
+	}
+	return sizes.Sizeof(types.Typ[types.UnsafePointer]), nil
+}
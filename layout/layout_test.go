@@ -0,0 +1,434 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layout
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var parseHeaderTests = []struct {
+	name   string
+	hdr    string
+	exprs  []string
+	types  []*Type
+	consts []*Const
+}{
+	{
+		name: "struct",
+		hdr: "// generated by cmd/compile\n" +
+			"#define T__size 24\n" +
+			"#define T_a 0\n" +
+			"#define T_b 8\n" +
+			"#define U__size 8\n",
+		types: []*Type{
+			{Name: "T", Size: 24, Symbol: "T__size", Fields: []Field{
+				{Name: "a", Offset: 0, Symbol: "T_a"},
+				{Name: "b", Offset: 8, Symbol: "T_b"},
+			}},
+			{Name: "U", Size: 8, Symbol: "U__size"},
+		},
+	},
+	{
+		name: "crlf",
+		hdr:  "#define T__size 16\r\n#define T_a 0\r\n#define T_b 8\r\n#define const_N 3\r\n",
+		types: []*Type{
+			{Name: "T", Size: 16, Symbol: "T__size", Fields: []Field{
+				{Name: "a", Offset: 0, Symbol: "T_a"},
+				{Name: "b", Offset: 8, Symbol: "T_b"},
+			}},
+		},
+		consts: []*Const{{Name: "N", Value: "3"}},
+	},
+	{
+		name: "consts",
+		hdr:  "#define const_Pi 3.14159\n#define const_Big 0x4000000000000000\n#define const_Bad\n",
+		consts: []*Const{
+			{Name: "Pi", Value: "3.14159"},
+			{Name: "Big", Value: "0x4000000000000000"},
+		},
+	},
+	{
+		name:  "expr",
+		hdr:   "#define " + exprPrefix + "0__size 16\n#define " + exprPrefix + "0_x 0\n",
+		exprs: []string{"[16]byte"},
+		types: []*Type{
+			{Name: "[16]byte", Expr: "[16]byte", Size: 16, Symbol: exprPrefix + "0__size"},
+		},
+	},
+	{
+		name: "wrapped",
+		hdr: "#define " + typePrefix + "M__size 8\n#define " + typePrefix + "M_x 0\n" +
+			"#define S__size 4\n#define S_x 0\n" +
+			"#define " + typePrefix + "S__size 4\n#define " + typePrefix + "S_x 0\n",
+		types: []*Type{
+			{Name: "M", Size: 8, Symbol: typePrefix + "M__size"},
+			{Name: "S", Size: 4, Symbol: "S__size", Fields: []Field{
+				{Name: "x", Offset: 0, Symbol: "S_x"},
+			}},
+		},
+	},
+}
+
+func TestParseHeader(t *testing.T) {
+	for _, tt := range parseHeaderTests {
+		p := new(Package)
+		parseHeader(p, []byte(tt.hdr), tt.exprs)
+		if !reflect.DeepEqual(p.Types, tt.types) {
+			t.Errorf("%s: types:\nhave %s\nwant %s", tt.name, dumpTypes(p.Types), dumpTypes(tt.types))
+		}
+		if !reflect.DeepEqual(p.Consts, tt.consts) {
+			t.Errorf("%s: consts = %v, want %v", tt.name, dumpConsts(p.Consts), dumpConsts(tt.consts))
+		}
+	}
+}
+
+func dumpTypes(list []*Type) string {
+	var s []string
+	for _, t := range list {
+		s = append(s, fmt.Sprintf("%+v", *t))
+	}
+	return strings.Join(s, "\n\t")
+}
+
+func dumpConsts(list []*Const) string {
+	var s []string
+	for _, c := range list {
+		s = append(s, c.Name+"="+c.Value)
+	}
+	return "[" + strings.Join(s, " ") + "]"
+}
+
+// load returns the types declared by the Go source src, which is
+// prefixed with a package clause, as Sizes would report them for
+// GOARCH=amd64: parsed from the go_asm.h lines that the compiler
+// writes for the struct types and for the structs wrapping the others,
+// and then type-checked.
+func load(t *testing.T, src string) *Package {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "x.go", "package p\n"+src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := types.SizesFor("gc", "amd64")
+	conf := types.Config{Sizes: sizes}
+	pkg, err := conf.Check("p", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The compiler omits blank fields from go_asm.h.
+	var hdr strings.Builder
+	for _, name := range pkg.Scope().Names() {
+		tn := pkg.Scope().Lookup(name).(*types.TypeName)
+		st, ok := tn.Type().Underlying().(*types.Struct)
+		if !ok {
+			fmt.Fprintf(&hdr, "#define %s%s__size %d\n", typePrefix, name, sizes.Sizeof(tn.Type()))
+			fmt.Fprintf(&hdr, "#define %s%s_x 0\n", typePrefix, name)
+			continue
+		}
+		fmt.Fprintf(&hdr, "#define %s__size %d\n", name, sizes.Sizeof(st))
+		vars := structFields(st)
+		offsets := sizes.Offsetsof(vars)
+		for i, v := range vars {
+			if v.Name() != "_" {
+				fmt.Fprintf(&hdr, "#define %s_%s %d\n", name, v.Name(), offsets[i])
+			}
+		}
+	}
+	p := new(Package)
+	parseHeader(p, []byte(hdr.String()), nil)
+	addTypes(p.Types, pkg, sizes, new(Options))
+	return p
+}
+
+const layoutSrc = `
+type T struct {
+	a byte
+	b int64
+	c byte
+}
+
+type Tail struct {
+	a int64
+	b byte
+}
+
+type Blank struct {
+	a byte
+	_ [3]byte
+	b int32
+}
+
+type Empty struct{}
+
+type C struct {
+	a int32
+	c complex64
+}
+
+type Iface struct {
+	r interface{ Read() }
+	e interface{}
+	p *int
+}
+
+type Scalars struct {
+	n int
+	s string
+	x [2]int32
+	m map[int]int
+}
+
+type NoPtrs struct {
+	a, b int64
+}
+
+type Celsius float64
+
+func (c Celsius) String() string { return "" }
+`
+
+var paddingTests = []struct {
+	name string
+	pad  []Pad
+	tail int64
+}{
+	{"T", []Pad{{1, 7}, {17, 7}}, 7},
+	{"Tail", []Pad{{9, 7}}, 7},
+	{"Blank", nil, 0},
+	{"Empty", nil, 0},
+	{"C", nil, 0},
+}
+
+func TestPadding(t *testing.T) {
+	p := load(t, layoutSrc)
+	for _, tt := range paddingTests {
+		typ := p.Lookup(tt.name)
+		if pad := typ.Padding(); !reflect.DeepEqual(pad, tt.pad) {
+			t.Errorf("%s.Padding() = %v, want %v", tt.name, pad, tt.pad)
+		}
+		if tail, ok := typ.TailPad(); !ok || tail != tt.tail {
+			t.Errorf("%s.TailPad() = %d, %v, want %d, true", tt.name, tail, ok, tt.tail)
+		}
+	}
+}
+
+func TestNotStruct(t *testing.T) {
+	p := load(t, layoutSrc)
+	typ := p.Lookup("Celsius")
+	if typ == nil || typ.Size != 8 {
+		t.Fatalf("Lookup(Celsius) = %+v, want size 8", typ)
+	}
+	if _, ok := typ.TailPad(); ok {
+		t.Errorf("Celsius.TailPad() reported ok for a non-struct type")
+	}
+	if pad := typ.Padding(); pad != nil {
+		t.Errorf("Celsius.Padding() = %v, want nil", pad)
+	}
+	if typ.FieldSizes() {
+		t.Errorf("Celsius.FieldSizes() = true, want false")
+	}
+	if typ.Obj == nil {
+		t.Fatalf("Celsius.Obj = nil, want the type-checked declaration")
+	}
+	if m := typ.Methods(); len(m) != 1 || m[0].Name != "String" {
+		t.Errorf("Celsius.Methods() = %v, want String", m)
+	}
+	if k := typ.Kind(); k != "basic" {
+		t.Errorf("Celsius.Kind() = %q, want basic", k)
+	}
+}
+
+func TestReorder(t *testing.T) {
+	p := load(t, layoutSrc)
+	fields, size := p.Lookup("T").Reorder()
+	want := []Field{{Name: "b", Offset: 0, Size: 8}, {Name: "a", Offset: 8, Size: 1}, {Name: "c", Offset: 9, Size: 1}}
+	if !reflect.DeepEqual(fields, want) || size != 16 {
+		t.Errorf("T.Reorder() = %v, %d, want %v, 16", fields, size, want)
+	}
+	if _, size := p.Lookup("C").Reorder(); size != 12 {
+		t.Errorf("C.Reorder() size = %d, want 12", size)
+	}
+}
+
+func TestMisaligned(t *testing.T) {
+	p := load(t, layoutSrc)
+	for _, typ := range p.Types {
+		if m := typ.Misaligned(); m != nil {
+			t.Errorf("%s.Misaligned() = %v, want nil for a compiler layout", typ.Name, m)
+		}
+	}
+
+	// A go_asm.h offset that disagrees with the type checker's layout,
+	// as for a type whose alignment the compiler does not honor.
+	typ := p.Lookup("T")
+	typ.Fields[1].Offset = 4
+	want := []Misalign{{Field: typ.Fields[1], Align: 8, By: 4}}
+	if m := typ.Misaligned(); !reflect.DeepEqual(m, want) {
+		t.Errorf("T.Misaligned() with b at offset 4 = %v, want %v", m, want)
+	}
+	typ = p.Lookup("C")
+	typ.Fields[1].Offset = 6
+	want = []Misalign{{Field: typ.Fields[1], Align: 4, By: 2}}
+	if m := typ.Misaligned(); !reflect.DeepEqual(m, want) {
+		t.Errorf("C.Misaligned() with c at offset 6 = %v, want %v", m, want)
+	}
+}
+
+var ptrMaskTests = []struct {
+	name string
+	mask []bool
+	scan int64
+}{
+	// Only an interface's data word is a pointer.
+	{"Iface", []bool{false, true, false, true, true}, 40},
+	{"Scalars", []bool{false, true, false, false, true}, 40},
+	{"NoPtrs", []bool{false, false}, 0},
+	{"T", []bool{false, false, false}, 0},
+}
+
+func TestPtrMask(t *testing.T) {
+	p := load(t, layoutSrc)
+	for _, tt := range ptrMaskTests {
+		typ := p.Lookup(tt.name)
+		if mask := typ.PtrMask(); !reflect.DeepEqual(mask, tt.mask) {
+			t.Errorf("%s.PtrMask() = %v, want %v", tt.name, mask, tt.mask)
+		}
+		if scan, ok := typ.ScanSize(); !ok || scan != tt.scan {
+			t.Errorf("%s.ScanSize() = %d, %v, want %d, true", tt.name, scan, ok, tt.scan)
+		}
+	}
+}
+
+var buildFlagsTests = []struct {
+	list    []string
+	gcflags string
+	out     []string
+}{
+	{nil, "", nil},
+	{nil, "-asmhdr=/tmp/x", []string{"-gcflags", "-asmhdr=/tmp/x"}},
+	{[]string{"-race"}, "-asmhdr=h", []string{"-race", "-gcflags", "-asmhdr=h"}},
+	{[]string{"-gcflags", "-N -l"}, "-asmhdr=h", []string{"-gcflags", "-N -l", "-gcflags", "-N -l -asmhdr=h"}},
+	{[]string{"--gcflags=all=-N"}, "-asmhdr=h", []string{"-gcflags", "all=-N", "-gcflags", "-N -asmhdr=h"}},
+	{[]string{"-gcflags=-m"}, "", []string{"-gcflags", "-m"}},
+}
+
+func TestBuildFlags(t *testing.T) {
+	for _, tt := range buildFlagsTests {
+		if out := buildFlags(tt.list, tt.gcflags); !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("buildFlags(%q, %q) = %q, want %q", tt.list, tt.gcflags, out, tt.out)
+		}
+	}
+}
+
+var asmhdrFlagTests = []struct {
+	file string
+	flag string
+}{
+	{"/tmp/rsc-io-sizeof-1", "-asmhdr=/tmp/rsc-io-sizeof-1"},
+	{`C:\Users\A User\tmp`, `-asmhdr 'C:\Users\A User\tmp'`},
+	{"/tmp/it's here", `-asmhdr "/tmp/it's here"`},
+}
+
+func TestAsmhdrFlag(t *testing.T) {
+	for _, tt := range asmhdrFlagTests {
+		if flag := asmhdrFlag(tt.file); flag != tt.flag {
+			t.Errorf("asmhdrFlag(%q) = %q, want %q", tt.file, flag, tt.flag)
+		}
+	}
+}
+
+var goflagsTagsTests = []struct {
+	goflags string
+	tags    string
+}{
+	{"", ""},
+	{"-trimpath", ""},
+	{"-tags=a,b -trimpath", "a,b"},
+	{"--tags=a -tags=b", "b"},
+}
+
+func TestGoflagsTags(t *testing.T) {
+	for _, tt := range goflagsTagsTests {
+		if tags := goflagsTags(tt.goflags); tags != tt.tags {
+			t.Errorf("goflagsTags(%q) = %q, want %q", tt.goflags, tags, tt.tags)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	var buf strings.Builder
+	opts := &Options{DryRun: &buf, TypeCheck: true, Env: []string{"GOARCH=386"}}
+	if err := dryRun("example.com/p", opts); err != ErrDryRun {
+		t.Fatalf("dryRun = %v, want ErrDryRun", err)
+	}
+	// The commands must appear in the order Sizes runs them.
+	out := buf.String()
+	rest := out
+	for _, cmd := range []string{
+		"DIR=$(GOARCH=386 go list -f '{{.Dir}}' example.com/p)",
+		"GOARCH=386 go list -f '{{.ImportPath}}",
+		"GOARCH=386 go env GOVERSION",
+		"GOARCH=386 go build -tags=rsc_io_sizeof_",
+		"GOARCH=386 go list -json -deps -export",
+	} {
+		i := strings.Index(rest, cmd)
+		if i < 0 {
+			t.Fatalf("dry run does not print %s in order:\n%s", cmd, out)
+		}
+		rest = rest[i+len(cmd):]
+	}
+
+	buf.Reset()
+	opts.NoCache, opts.TypeCheck = true, false
+	dryRun("", opts)
+	if out := buf.String(); strings.Contains(out, "GOVERSION") || strings.Contains(out, "-export") {
+		t.Errorf("dry run with NoCache and without TypeCheck prints go env or go list -export:\n%s", out)
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go build in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/p\n\ngo 1.22\n",
+		"p.go":   "package p\n\ntype T struct {\n\ta byte\n\tb int64\n}\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, s := range []Strategy{StrategyAsmhdr, StrategyWork} {
+		p, err := Sizes("", Options{Dir: dir, NoCache: true, Strategy: s, TempDir: t.TempDir()})
+		if err != nil {
+			t.Errorf("strategy %s: %v", s, err)
+			continue
+		}
+		typ := p.Lookup("T")
+		if typ == nil || typ.Size != 16 || len(typ.Fields) != 2 || typ.Fields[1].Offset != 8 {
+			t.Errorf("strategy %s: T = %+v, want size 16 with b at offset 8", s, typ)
+		}
+		if list, _ := filepath.Glob(filepath.Join(dir, "xxx_rsc_io_sizeof_*")); len(list) > 0 {
+			t.Errorf("strategy %s left stub files %v", s, list)
+		}
+	}
+}
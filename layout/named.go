@@ -0,0 +1,81 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layout
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+)
+
+// typePrefix is the prefix of the names of the struct types that wrap
+// the package's non-struct named types. The compiler only writes the sizes
+// of struct types to go_asm.h, so without the wrappers a type such as
+// type cache map[string]int would have no size.
+const typePrefix = "xxx_rsc_io_sizeof_type_"
+
+// namedTypes returns the names of the package-level named types declared
+// in the Go source files that are not struct types and so can be measured
+// only by wrapping them in a struct. Aliases and generic types are omitted:
+// an alias has the size of the type it names, which is reported under that
+// name, and a generic type has no size until it is instantiated.
+// The generic types are returned separately, in generic.
+// Files that cannot be parsed are skipped; the build reports the errors.
+func namedTypes(dir string, files []string) (names, generic []string) {
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, file), nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		for _, decl := range f.Decls {
+			d, ok := decl.(*ast.GenDecl)
+			if !ok || d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if ts.Name.Name == "_" || ts.Assign.IsValid() {
+					continue
+				}
+				if ts.TypeParams != nil {
+					generic = append(generic, ts.Name.Name)
+					continue
+				}
+				if _, ok := ts.Type.(*ast.StructType); ok {
+					continue
+				}
+				if it, ok := ts.Type.(*ast.InterfaceType); ok && isConstraint(it) {
+					continue
+				}
+				names = append(names, ts.Name.Name)
+			}
+		}
+	}
+	return names, generic
+}
+
+// isConstraint reports whether the interface type it can only be
+// used as a type constraint, because it lists types such as ~int
+// or int | string, or embeds comparable.
+func isConstraint(it *ast.InterfaceType) bool {
+	for _, f := range it.Methods.List {
+		if len(f.Names) > 0 {
+			continue
+		}
+		switch t := f.Type.(type) {
+		case *ast.Ident:
+			if t.Name == "comparable" {
+				return true
+			}
+		case *ast.SelectorExpr:
+			// Embedded interface from another package.
+		default:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layout
+
+import "go/types"
+
+// PtrMask returns the pointer bitmap of t: one entry per pointer-sized word
+// of t, reporting whether the garbage collector treats that word as a pointer.
+// The go_asm.h file has no GC metadata, so the bitmap is computed from the
+// type-checked declaration, following the rules the compiler uses.
+// PtrMask returns nil if t's type is unknown.
+func (t *Type) PtrMask() []bool {
+	if t.Obj == nil {
+		return nil
+	}
+	word := t.sizes.Sizeof(types.Typ[types.UnsafePointer])
+	mask := make([]bool, (t.Size+word-1)/word)
+	markPtrs(mask, t.Obj.Type(), 0, word, t.sizes)
+	return mask
+}
+
+// ScanSize returns the number of bytes at the start of a value of type t
+// that the garbage collector must scan: the end of the last pointer word.
+// The rest of the value holds no pointers and is not scanned.
+// A type with no pointers has scan size 0, and the runtime allocates
+// its values as noscan. ScanSize reports false if t's type is unknown.
+func (t *Type) ScanSize() (int64, bool) {
+	mask := t.PtrMask()
+	if mask == nil {
+		return 0, false
+	}
+	word := t.sizes.Sizeof(types.Typ[types.UnsafePointer])
+	for i := len(mask) - 1; i >= 0; i-- {
+		if mask[i] {
+			return int64(i+1) * word, true
+		}
+	}
+	return 0, true
+}
+
+// markPtrs marks the pointer words of a value of type typ stored at offset off.
+func markPtrs(mask []bool, typ types.Type, off, word int64, sizes types.Sizes) {
+	mark := func(off int64) {
+		if i := off / word; i < int64(len(mask)) {
+			mask[i] = true
+		}
+	}
+	switch typ := typ.Underlying().(type) {
+	case *types.Basic:
+		switch typ.Kind() {
+		case types.String, types.UnsafePointer:
+			mark(off)
+		}
+	case *types.Pointer, *types.Map, *types.Chan, *types.Signature:
+		mark(off)
+	case *types.Slice:
+		mark(off)
+	case *types.Interface:
+		// Only the data word: the type or itab word points to
+		// memory the garbage collector does not manage.
+		mark(off + word)
+	case *types.Array:
+		if !hasPtrs(typ.Elem()) {
+			break
+		}
+		elem := sizes.Sizeof(typ.Elem())
+		for i := int64(0); i < typ.Len(); i++ {
+			markPtrs(mask, typ.Elem(), off+i*elem, word, sizes)
+		}
+	case *types.Struct:
+		fields := structFields(typ)
+		offsets := sizes.Offsetsof(fields)
+		for i, f := range fields {
+			markPtrs(mask, f.Type(), off+offsets[i], word, sizes)
+		}
+	}
+}
+
+// hasPtrs reports whether a value of type typ contains any pointers.
+func hasPtrs(typ types.Type) bool {
+	switch typ := typ.Underlying().(type) {
+	case *types.Basic:
+		return typ.Kind() == types.String || typ.Kind() == types.UnsafePointer
+	case *types.Array:
+		return typ.Len() > 0 && hasPtrs(typ.Elem())
+	case *types.Struct:
+		for i := 0; i < typ.NumFields(); i++ {
+			if hasPtrs(typ.Field(i).Type()) {
+				return true
+			}
+		}
+		return false
+	case *types.TypeParam:
+		return false
+	}
+	return true
+}
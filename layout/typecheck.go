@@ -0,0 +1,271 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layout
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A listPackage is the subset of the go list -json output used by typeCheck.
+type listPackage struct {
+	Dir        string
+	ImportPath string
+	Export     string
+	GoFiles    []string
+	CgoFiles   []string
+	ImportMap  map[string]string
+	DepOnly    bool
+}
+
+// TypeCheck type-checks the package p, as returned by Sizes,
+// filling in the information that Sizes adds when opts.TypeCheck is set.
+// It does nothing if p has already been type-checked.
+func TypeCheck(p *Package, opts Options) error {
+	if p.TypesPackage != nil {
+		return nil
+	}
+	return typeCheck(p, &opts)
+}
+
+// typeCheck type-checks the package p from source,
+// importing its dependencies from the export data written by go list -export,
+// and fills in the alignments, field sizes, and field types of p's types.
+func typeCheck(p *Package, opts *Options) error {
+	args := opts.goArgs("list", "-json", "-deps", "-export")
+	opts.logf("go %s (in %s)", strings.Join(args, " "), p.Dir)
+	cmd := exec.Command(opts.goCmd(), args...)
+	cmd.Dir = p.Dir
+	cmd.Env = opts.environ()
+	start := time.Now()
+	out, err := opts.output("go list", cmd)
+	opts.timed("go list", start)
+	if err != nil {
+		return err
+	}
+	defer opts.timed("type-check", time.Now())
+
+	var target *listPackage
+	exports := make(map[string]string)
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		lp := new(listPackage)
+		if err := dec.Decode(lp); err != nil {
+			return fmt.Errorf("go list: %v", err)
+		}
+		exports[lp.ImportPath] = lp.Export
+		if !lp.DepOnly {
+			target = lp
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("go list: no package in %s", p.Dir)
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range append(target.GoFiles, target.CgoFiles...) {
+		f, err := parser.ParseFile(fset, filepath.Join(target.Dir, name), nil, 0)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+
+	sizes := types.SizesFor("gc", p.GOARCH)
+	if sizes == nil {
+		return fmt.Errorf("unknown architecture %s", p.GOARCH)
+	}
+
+	gc := importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		file := exports[path]
+		if file == "" {
+			return nil, fmt.Errorf("no export data for %s", path)
+		}
+		return os.Open(file)
+	})
+	conf := types.Config{
+		Importer: importerFunc(func(path string) (*types.Package, error) {
+			if p, ok := target.ImportMap[path]; ok {
+				path = p
+			}
+			return gc.Import(path)
+		}),
+		Sizes:       sizes,
+		FakeImportC: true,
+		// The package has already been built successfully,
+		// so any errors here are artifacts of type-checking
+		// cgo files without running cgo. Keep going.
+		Error: func(err error) {
+			opts.logf("type-check: %v", err)
+		},
+	}
+	pkg, _ := conf.Check(target.ImportPath, fset, files, nil)
+	p.TypesPackage = pkg
+	p.TypesSizes = sizes
+	addTypes(p.Types, pkg, sizes, opts)
+	p.Interfaces = interfaces(pkg, sizes)
+	addConsts(p, pkg)
+	return nil
+}
+
+// addConsts adds to p the package-level constants in pkg that go_asm.h
+// leaves out, such as floating-point constants, in declaration order.
+func addConsts(p *Package, pkg *types.Package) {
+	have := make(map[string]bool)
+	for _, c := range p.Consts {
+		have[c.Name] = true
+	}
+	var list []*types.Const
+	for _, name := range pkg.Scope().Names() {
+		if c, ok := pkg.Scope().Lookup(name).(*types.Const); ok && !have[name] && name != "_" {
+			list = append(list, c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Pos() < list[j].Pos()
+	})
+	for _, c := range list {
+		p.Consts = append(p.Consts, &Const{Name: c.Name(), Value: constString(c.Val())})
+	}
+}
+
+// constString returns the value v formatted as in go_asm.h,
+// with floating-point and complex values in the shortest form
+// that preserves their float64 (or complex128) value.
+func constString(v constant.Value) string {
+	switch v.Kind() {
+	case constant.String:
+		return strconv.Quote(constant.StringVal(v))
+	case constant.Int:
+		return v.ExactString()
+	case constant.Float:
+		if f, _ := constant.Float64Val(v); !math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+	case constant.Complex:
+		re, _ := constant.Float64Val(constant.Real(v))
+		im, _ := constant.Float64Val(constant.Imag(v))
+		if !math.IsInf(re, 0) && !math.IsInf(im, 0) {
+			return strconv.FormatComplex(complex(re, im), 'g', -1, 128)
+		}
+	}
+	return v.String()
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// addTypes records the go/types information for each of the types,
+// filling in the field sizes that go_asm.h leaves out.
+func addTypes(list []*Type, pkg *types.Package, sizes types.Sizes, opts *Options) {
+	for _, t := range list {
+		if t.Expr != "" {
+			continue
+		}
+		tn, ok := pkg.Scope().Lookup(t.Name).(*types.TypeName)
+		if !ok {
+			opts.logf("type-check: cannot find type %s", t.Name)
+			continue
+		}
+		t.Align = sizes.Alignof(tn.Type())
+		t.under = tn.Type().Underlying()
+		t.Obj = tn
+		t.sizes = sizes
+		st, ok := tn.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		byName := make(map[string]*types.Var)
+		for i := 0; i < st.NumFields(); i++ {
+			byName[st.Field(i).Name()] = st.Field(i)
+		}
+		offsets := sizes.Offsetsof(structFields(st))
+		for i := 0; i < st.NumFields(); i++ {
+			if v := st.Field(i); v.Name() == "_" {
+				t.blank = append(t.blank, Field{Name: "_", Offset: offsets[i], Size: sizes.Sizeof(v.Type())})
+			}
+		}
+		complete := true
+		for i := range t.Fields {
+			f := &t.Fields[i]
+			v := byName[f.Name]
+			if v == nil {
+				complete = false
+				continue
+			}
+			f.Size = sizes.Sizeof(v.Type())
+			f.Type = types.TypeString(v.Type(), qualifier(pkg))
+		}
+		t.known = complete
+	}
+}
+
+// interfaces returns the named interface types declared in pkg,
+// in declaration order.
+func interfaces(pkg *types.Package, sizes types.Sizes) []*Interface {
+	var list []*types.TypeName
+	for _, name := range pkg.Scope().Names() {
+		tn, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		// Constraint interfaces such as interface{ ~int }
+		// cannot be the types of values.
+		if it, ok := tn.Type().Underlying().(*types.Interface); ok && it.IsMethodSet() {
+			list = append(list, tn)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Pos() < list[j].Pos()
+	})
+	var ifaces []*Interface
+	for _, tn := range list {
+		it := tn.Type().Underlying().(*types.Interface)
+		ifaces = append(ifaces, &Interface{
+			Name:    tn.Name(),
+			Size:    sizes.Sizeof(it),
+			Methods: it.NumMethods(),
+		})
+	}
+	return ifaces
+}
+
+// qualifier returns a types.Qualifier that omits pkg
+// and identifies other packages by name.
+func qualifier(pkg *types.Package) types.Qualifier {
+	return func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+		return p.Name()
+	}
+}
+
+// structFields returns the fields of st.
+func structFields(st *types.Struct) []*types.Var {
+	var fields []*types.Var
+	for i := 0; i < st.NumFields(); i++ {
+		fields = append(fields, st.Field(i))
+	}
+	return fields
+}
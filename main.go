@@ -6,25 +6,618 @@
 //
 // Usage:
 //
-//	sizeof [-c] [-f] [-p path] [-v] [name...]
+//	sizeof [command] [options] [name...]
 //
 // Sizeof prints the size of Go types in a given package.
 //
+// The optional command selects what to print, as an alternative to the
+// equivalent options:
+//
+//	types   print type sizes (the default)
+//	consts  print constant values, like -c
+//	fields  print type sizes and field offsets, like -f
+//
+// Each command accepts only the options that apply to it: for example,
+// sizeof consts rejects -f, and sizeof types rejects -c. Running sizeof
+// consts -h lists the options for constants. Without a command, all options
+// are accepted, as before. To print a type named types, consts, or fields,
+// put an option or a command first, as in sizeof types fields.
+//
 // If the -p option is given, sizeof compiles the package named by the import path.
 // Otherwise it compiles the package in the current directory.
+// The -p option may be repeated or given a comma-separated list of import paths,
+// in which case sizeof compiles each package in turn and qualifies each printed
+// name with its import path, as in regexp/syntax.Regexp. If a package fails to
+// build, sizeof reports the error and continues with the remaining packages.
+// An import path may also be a pattern such as ./... or std, which sizeof
+// expands to the list of matching packages using ``go list.''
+// With -json, each object then has a "package" key.
 //
 // If type names are given on the command line, sizeof prints the size of those types.
 // Otherwise it prints the size of all named types in the package.
+// Unexported types are included. The compiler reports only the sizes of struct
+// types, so sizeof measures other named types, such as type cache map[string]int,
+// by compiling an extra file that wraps each one in a struct. Generic types,
+// which have no size until instantiated, are omitted; use -expr to measure
+// an instantiation.
+//
+// If the -names option is given, sizeof reads additional names from the named
+// file, one per line, or from standard input if the file is -. Blank lines and
+// lines beginning with # are ignored. The names are added to any given on the
+// command line and are treated the same way, as exact names, prefixes, or
+// regular expressions.
+//
+// Names may also follow a -p option, in which case they are sought only in
+// the packages it names, and a missing one is reported along with its package:
+//
+//	sizeof -p net/http Request Response -p net/url URL
+//
+// prints net/http.Request, net/http.Response, and net/url.URL.
+// Names before the first -p option are sought in every package.
+//
+// A name may also be qualified by an import path, as in
+//
+//	sizeof net/http.Request net/url.URL
+//
+// which is shorthand for -p net/http Request -p net/url URL. Unqualified
+// names given along with qualified ones are sought in the package in the
+// current directory, or, if the -p option is given, in every package.
+// Qualified names are not recognized with -r or -prefix-match.
+//
+// If a name is not found as a type but the package declares it as a function,
+// variable, or constant, sizeof says so, as in Getenv is a func, not a type.
+//
+// If the -builtin option is given, sizeof prints the sizes of the headers of Go's
+// built-in types instead of types in a package: pointer, string, slice, map,
+// chan, func, interface, and eface (the empty interface). With -f, it also
+// prints the fields of the string, slice, and interface headers, named as in
+// the runtime. The sizes are computed for the target GOARCH, so -builtin works
+// in any directory, and it combines with -goarch, -arch, and -diff -arch.
+// For example, sizeof -builtin -arch 386,amd64 slice compares slice headers.
+//
+// If the -expr option is given, sizeof prints the size of the given type
+// expression, such as [16]byte, []string, or map[int]*T, instead of the sizes
+// of types in the package. The expression is compiled in the context of the
+// package, so it may refer to the package's types. The -expr option may be
+// repeated. Types named on the command line are still printed.
+//
+// A generic type has no size until it is instantiated. To measure one,
+// name it with its type arguments, as in
+//
+//	sizeof 'List[int]' 'Pair[string, error]'
+//
+// which sizeof treats like -expr. Naming a generic type without type
+// arguments prints an error saying so.
+//
+// If the -q option is given, sizeof does not report names on the command line
+// that match no type, and such names do not cause a nonzero exit status.
+// This makes it safe to probe for a list of names that may not all exist.
+// The -q option also suppresses the note that sizeof prints when it must force
+// the compiler to run on a package that is already up to date by running
+// go build -a, rebuilding all the package's dependencies as well, because it
+// cannot add a temporary source file to the package. The usual recompilation
+// using such a file is noted only with -v.
+//
+// If the -exclude option is given, sizeof omits the types it names, even if they
+// match the names on the command line, as in -exclude Debug,Trace.
+// With -r, the excluded names are regular expressions, so that
+//
+//	sizeof -r . -exclude ^Test
+//
+// prints all types except those whose names begin with Test.
+// Excluded names on the command line are not reported as missing.
+// The -exclude option applies to constants and interfaces as well.
+//
+// If the -r option is given, the names on the command line are instead regular
+// expressions, and sizeof prints the size of every type whose name matches
+// any of them. The expressions are not anchored: use ^ and $ to match whole names.
+//
+// If the -words option is given, sizeof also prints each type's size in machine
+// words for the target architecture, rounded up, as in Regexp 160 (20 words).
+//
+// If the -count option is given, sizeof prints only the number of types that
+// match the command line, or of constants with -c, as a single integer. The
+// count respects the names given, -r, -prefix-match, and -exclude, and covers
+// all the packages given by -p. Checks such as -max are not made.
+//
+// If the -relative-to option is given, sizeof also prints each type's size as
+// a multiple of the size of the named baseline type, rounded to two decimal
+// places, as in Response 96 (3.2x Request) for -relative-to Request. The
+// baseline must be one of the package's measured types; it need not be among
+// the names printed. With several packages, each must have the baseline.
+//
+// If the -symbols option is given, sizeof also prints the go_asm.h symbol from
+// which it read each size and, with -f, each offset, as in Regexp 160
+// [Regexp__size] and Regexp.prog 16 [Regexp_prog], to help debug other tools
+// that read the header. Types that sizeof measured by wrapping them in a struct,
+// such as non-struct types and -expr expressions, show the wrapper's symbol.
+//
+// If the -kind option is given, sizeof also prints the kind of each type's
+// underlying type after its size: struct, array, slice, map, chan, func,
+// pointer, interface, or basic, as in Celsius 8 basic for type Celsius float64
+// or L 24 slice for type L []int.
 //
 // If the -f option is given, sizeof also prints field locations for each type.
 //
-// If the -c option is given, sizeof ignores types and instead prints the values of integer constants.
+// If the -fields-only option is given, sizeof prints the field locations as -f does,
+// but not the lines giving type sizes, so that the output holds only lines such as
+// Regexp.prog 16. Conversely, if the -sizes-only option is given, sizeof prints
+// only the type sizes, omitting the field locations even if -f is also given.
+// Both apply to -csv as well.
+//
+// If the -prefix-lines option is given, each line giving a type size begins
+// with type:, each field location with field:, and each constant with const:,
+// as in type:Regexp 160 and field:Regexp.prog 16, so that grep ^field: finds
+// the field lines whatever the names. Other lines, such as those added by
+// -pad or -scan, are unchanged.
+//
+// If the -arrays option is given along with -f, sizeof also describes each field
+// of array type by its element size and length, as in Buf.data 0 [4096]byte elem=1 len=4096.
+// For an array of arrays, the length lists each dimension, outermost first, as in
+// Grid.cells 0 [3][4]int32 elem=4 len=3x4.
+//
+// If the -embed option is given along with -f, sizeof also prints the fields
+// promoted from each embedded struct field, after that field, named by their
+// full path and with offsets relative to the outer type, as in
+// Outer.Inner.field 24. Fields of structs embedded within embedded structs
+// are included as well. Fields reached through an embedded pointer are not
+// part of the type's layout and are not shown.
+//
+// If the -total-pad option is given, sizeof also sums the padding, internal
+// and tail, in all the struct types it printed, across all packages, and
+// prints the total followed by the types with padding, most first, as in
+//
+//	# total padding: 23 bytes in 3 of 14 struct types
+//	# Pad 14
+//	# Node 8
+//	# Mid 1
+//
+// As with -sum, each line begins with #, so that scripts can skip them.
+//
+// If the -explain option is given, sizeof also explains the size of each
+// struct type, listing its fields in order with their sizes and the padding
+// inserted before each one to align it, and the tail padding that rounds
+// the size up to a multiple of the type's alignment. For example, for
+// type T struct { a byte; b int64; c byte }, it prints
+// T explain 24 bytes = 1 (a) + 7 pad + 8 (b) + 1 (c) + 7 tail pad.
+//
+// If the -flat option is given along with -f, sizeof instead prints only the
+// leaf fields of each struct, those not themselves of struct type, descending
+// into embedded and named struct fields alike at any depth. Each is named by
+// its full path and printed at its offset from the start of the outer type,
+// as in Outer.Inner.field 24, giving the byte layout as one flat list.
+//
+// If the -cacheline option is given along with -f, sizeof also marks the cache
+// line boundaries among the fields, with a line T.<cacheline> offset before
+// the first field in each new cache line, and follows
+// the fields with a line T <cachelines> n giving the number of cache lines the
+// type spans, assuming that it starts at the beginning of a line. Then, for each
+// cache line holding more than one field, it prints a line
+// T <shared offset> field... listing the fields in the cache line starting at
+// offset. Fields that share a cache line are prone to false sharing when
+// written by different goroutines. Cache lines are 64 bytes; to use a different
+// size, give it as the option's value, as in -cacheline=128.
+//
+// If the -align option is given, sizeof also prints a line T align n giving
+// the alignment of each type. The go_asm.h file does not record alignment,
+// so sizeof computes it by type-checking the package: a struct's alignment is
+// the largest alignment of any of its fields.
+//
+// If the -nextfree option is given, sizeof also prints a line such as
+// Regexp size=160 align=8 nextfree=160, giving the size and alignment of each
+// type and the offset at which a field following it would be placed if it were
+// embedded at offset 0 of a struct: the size rounded up to the alignment.
+//
+// If the -prefix-match option is given, the names on the command line are instead
+// prefixes, and sizeof prints every type (or constant, with -c) whose name begins
+// with any of them.
+//
+// If the -t option is given along with -f, sizeof also prints the Go type of
+// each field after its offset, as in Regexp.prog 16 *syntax.Prog.
+// Embedded fields are shown with their embedded type.
+//
+// If the -pad option is given, sizeof also prints the padding in each type:
+// a line T.<pad> offset n for each run of n padding bytes, both between fields
+// and at the end of the type, followed by a line T <pad> total giving the
+// total number of padding bytes in T. Computing padding requires the size of
+// each field, which sizeof finds by type-checking the package.
+//
+// If the -ptr option is given, sizeof also prints a line T ptrs p/n giving
+// the number of words p in T that hold pointers, out of n words in total,
+// to help find types that are expensive for the garbage collector to scan.
+// The go_asm.h file has no garbage collector information, so sizeof computes
+// the pointer words by type-checking the package.
+//
+// If the -scan option is given, sizeof also prints a line T scan s/n giving
+// the number of bytes s at the start of T that the garbage collector scans,
+// ending with the last word that holds a pointer, out of T's size n. The
+// remaining bytes hold no pointers and are skipped. A type with no pointers
+// prints T scan 0 noscan: the runtime allocates it without scanning at all.
+// Placing the pointer fields first in a struct reduces its scan size.
+//
+// If the -biggest-field option is given, sizeof also prints a line
+// T biggest=f(n) for each struct type T, naming its largest field f and giving
+// its size n, as a quick way to find the field that dominates a large struct.
+// Ties go to the first such field. Field sizes come from type-checking the
+// package.
+//
+// If the -iface option is given, naming an interface such as Namer, error,
+// or io.Reader, sizeof also prints, for each type T that implements it,
+// the cost of storing a T in the interface, as in
+//
+//	T iface Namer itab=32 boxed=24 total=56
+//
+// The itab, which the runtime allocates once for each pair of interface and
+// concrete type, holds two pointers, a hash, and a word for each method.
+// A pointer-shaped value, such as a pointer or map, fits inline in the
+// interface; any other value is boxed, copied to an allocation of its size,
+// each time it is converted. If only *T implements the interface, the line
+// says via *T, and the pointer fits inline. Interface types are not shown.
+//
+// If the -deep option is given, sizeof also prints a line
+// T deep inline=n indirect=m total=n+m estimating the memory used by a value of
+// type T, counting both the n bytes of T itself and the m bytes allocated
+// separately and referenced from it, such as the array behind a slice field.
+// The real amount depends on the data, so sizeof assumes that every pointer
+// points to one value, that every slice, map, and string holds the number of
+// elements (or bytes) given by -deeplen, 1 by default, and that channels,
+// functions, and interfaces refer to nothing. The overhead of map hash tables
+// is not counted. The referenced values are expanded in turn, but a type that
+// refers back to itself, as in a linked list, is expanded only once.
+//
+// If the -interfaces option is given, sizeof also prints a line for each
+// named interface type, which go_asm.h omits, giving its number of methods
+// and its size, as in Stringer iface methods=1 size=16. Every interface
+// value is two words; the method count gives the size of the method table
+// in the itab created for each concrete type stored in the interface.
+// Empty interfaces, which have no itab, are shown as eface instead of iface.
+// The interfaces are found by type-checking the package.
+//
+// If the -color option is given, sizeof colors the type lines printed with -pad
+// or -f according to the type's padding: red if at least an eighth of the type
+// is padding, and green if it has no padding at all. The value may be "auto"
+// (the default), to use color only when the results go to a terminal, "always",
+// or "never". Color is never used with -json or -csv, or when the NO_COLOR
+// environment variable is set.
+//
+// If the -methods option is given, sizeof also lists the methods declared
+// on each type, marking which have pointer receivers and which have value
+// receivers, which copy the whole value on each call, as in
+// Regexp.Match (value copy 160 bytes) or Regexp.Longest (pointer).
+// Methods promoted from embedded fields are not listed.
+//
+// If the -cost option is given, sizeof also prints how many bytes each field
+// adds to its struct: the field's size plus the padding inserted before it,
+// as in Regexp.expr costs 16 (+0 pad), followed by the padding at the end
+// of the struct, as in Regexp <tail pad> 0. The costs and the tail padding
+// add up to the size of the struct.
+//
+// If the -map option is given, sizeof also draws the memory layout of each
+// struct, one line per 8 bytes, with each byte shown as the letter assigned
+// to the field occupying it, or as a dot for padding. A legend follows,
+// listing the field for each letter. Runs of identical lines are shown as *.
+// A struct larger than 4096 bytes is drawn with each cell standing for a power
+// of two bytes, as noted in the first line, so that it takes at most 512 lines.
+//
+// If the -reorder option is given, sizeof also suggests an order for the fields
+// of each struct that minimizes its size. It prints a line T <size -> newsize>
+// followed, if the new order is smaller, by lines T.field offset giving each field's
+// offset in the new order. The suggested order places zero-size fields first
+// and then sorts the remaining fields by decreasing alignment, keeping fields
+// with equal alignment in their original order.
+//
+// If the -top option is given, sizeof prints only the given number of largest
+// types, largest first, as in -top 10. When several packages are named,
+// the largest types are chosen from all of them together, so that
+//
+//	sizeof -top 10 -p ./...
+//
+// lists the ten largest types in a module.
+//
+// If the -recursive option is given, sizeof also prints, after each type,
+// the named types reachable from it through the types of its fields,
+// and theirs in turn, including through pointers, slices, arrays, maps,
+// and channels. Each is printed once, the first time it is reached,
+// indented by one tab for each level below the type, as in
+//
+//	Node 40
+//		Data 24
+//			sync.Mutex 8
+//
+// Types in other packages are qualified by import path.
+//
+// If the -dot option is given, sizeof instead prints a Graphviz graph of the
+// types and those reachable from them, as with -recursive. Each node is a type
+// labeled with its size, and each edge leads from a type to a type used by its
+// fields, labeled with the names of the fields. To draw the graph, use
+//
+//	sizeof -dot | dot -Tpng >types.png
+//
+// If the -sum option is given, sizeof ends its output with a summary of the
+// printed types: their number, total size, largest type, and average size.
+// Each summary line begins with #. The summary is not printed with -json,
+// -c, or -arch.
+//
+// If the -c option is given, sizeof ignores types and instead prints the values of constants.
+// Integer, boolean, and string constants are printed as they appear in go_asm.h,
+// with strings quoted, as in Version "1.2.3". The go_asm.h file cannot represent
+// other constants, so sizeof finds them by type-checking the package and prints
+// floating-point and complex values in their shortest exact float64 form,
+// as in Pi 3.141592653589793.
+//
+// If the -all option is given, sizeof prints both the sizes of types and the
+// values of constants, in two sections introduced by the lines # type sizes
+// and # constants. The names on the command line select from both.
+// With -json, the constants are listed under "consts".
+//
+// If the -prefix option is given along with -c or -all, sizeof prints only the constants
+// whose names begin with the given prefix, as in -prefix SIG.
+// When -prefix or -prefix-match is given, constants are printed in name order.
+//
+// If the -hex option is given, sizeof prints integer constant values, as well as
+// sizes and offsets, in hexadecimal, as in 0x10 or -0x3. The -hex option does
+// not affect JSON output.
+//
+// If the -dechex option is given, sizeof prints sizes and offsets twice, in
+// decimal and then in hexadecimal, as in Regexp.prog 16 0x10, which is
+// convenient for comparing with a debugger. Constant values are unaffected.
+//
+// Sizeof sorts its results by name, so that its output is the same from run to run
+// and from one Go release to the next, making it suitable for golden files.
+// (Earlier versions of sizeof printed types in the order the compiler reported them.)
+// The -sort option selects a different order: "size" (largest first, ties broken
+// by name), "offset" (types and constants in the order the compiler reports
+// them), or "fields" (most fields first, ties broken by name, with the number
+// of fields printed after each size, as in T 24 (4 fields)). In all cases, the fields listed by -f stay with their type, sorted by offset.
+// Constants are sorted by name for any order but "offset".
+//
+// If the -template option is given, sizeof prints each type by executing the
+// given text/template, followed by a newline, as in -template '{{.Name}}={{.Size}}'.
+// The template's data has these fields:
+//
+//	Name    string  // type name, qualified by package when several are named
+//	Package string  // import path, when several packages are named
+//	Size    int64   // size in bytes
+//	Align   int64   // alignment in bytes
+//	Words   int64   // size in machine words, rounded up
+//	Fields  []Field // fields, each with Name, Offset, Size, and Type
+//
+// The default output, with -f, is the same as that of the template
+//
+//	{{.Name}} {{.Size}}{{range .Fields}}
+//	{{$.Name}}.{{.Name}} {{.Offset}}{{end}}
+//
+// except that it aligns the columns. Sizeof reports errors in the template
+// before building anything.
+//
+// If the -json option is given, sizeof prints its results as a single JSON object
+// instead of lines of text, as in
+//
+//	{"schema": 2, "goos": "linux", "goarch": "amd64", "types": [...]}
+//
+// The "schema" key gives the version of the document's structure, which
+// is incremented whenever the structure changes incompatibly. The "goos" and
+// "goarch" keys give the target system; with -arch, "goarch" is an array of the
+// architectures. The "types" key holds an array of types, and the "consts" and
+// "interfaces" keys hold the constants printed by -c or -all and the interfaces
+// printed by -interfaces. Each type is an object with "name" and "size" keys.
+// Other options add keys to the object:
+//
+//	-f        "fields": an array of objects with "name", "offset", and "size" keys
+//	-t        "type": the field's type, in each field object
+//	-align    "align": the type's alignment
+//	-kind     "kind": the kind of the type's underlying type
+//	-relative-to "relative": the size as a multiple of the baseline's size
+//	-symbols  "symbol": the go_asm.h symbol for the size
+//	-nextfree "align", and "nextfree": the size rounded up to the alignment
+//	-pad      "pad": the total padding bytes
+//	-ptr      "ptrs": an object with "ptrs" and "words" keys
+//	-scan     "scan": the number of bytes the garbage collector scans
+//	-biggest-field "biggestField": an object with "name" and "size" keys
+//	-iface    "iface": an object with "name", "pointer", "itab", "inline",
+//	          "boxed", and "total" keys
+//	-deep     "deep": an object with "inline", "indirect", and "total" keys
+//	-cacheline "cachelines": the number of cache lines, and "shared": an array
+//	          of objects with "line" and "fields" keys
+//	-reorder  "reorder": an object with "name", "size", and "fields" keys
+//	-methods  "methods": an array of objects with "name" and "pointer" keys
+//
+// Under -c, each constant is an object with "name" and "value" keys.
+//
+// If the -jsonl option is given, sizeof prints its results as JSON Lines
+// instead: one JSON object per line for each type, constant, or interface,
+// with the same keys as in the "types", "consts", and "interfaces" arrays of
+// the -json document, including the "fields" array of -f within each type.
+// There is no enclosing document, so the target system is not given.
+// Options that apply to -json apply to -jsonl as well.
+//
+// If the -csv option is given, sizeof prints its results as comma-separated
+// records for importing into a spreadsheet, starting with a header row naming
+// the columns. The columns are name and size; with -f, they are type, field,
+// offset, and size, with one record for each type, giving its size, followed by
+// one record for each of its fields. Under -c, the columns are name and value;
+// under -arch, they are name followed by one column per architecture.
+// Names containing commas or quotes are quoted. Other options that add
+// information to the output, such as -pad, do not apply to -csv records.
+//
+// If the -arch option is given, sizeof builds the package once for each GOARCH
+// value in the comma-separated list and prints a table with one row per type
+// (or field, with -f; or constant, with -c) and one column per architecture.
+// A dash marks a type that does not exist for a given architecture, and an
+// asterisk at the end of a row marks a type whose size differs between
+// architectures, because of pointer sizes or of declarations gated by build
+// constraints, so that layouts that are not portable stand out.
+// With -json, each type (or constant, with -c) is an object with a "name" key
+// and a "size" object mapping architecture to size or value, and a row that
+// differs has a "divergent" key set to true. The types follow the -sort order,
+// using the sizes for the first architecture that has each type, and each type's
+// fields follow it in offset order. Other options
+// that add information to the output, such as -pad, do not apply to -arch tables.
+//
+// If the -o option is given, sizeof writes its results to the named file
+// instead of standard output. Diagnostics still go to standard error.
+// The name - means standard output. The file is replaced only when sizeof
+// finishes without an error, so a failed run leaves an existing file alone.
+//
+// If the -min-size option is given, sizeof prints only the types at least
+// the given number of bytes in size, along with their fields for -f; smaller
+// types are left out entirely. A smaller type named on the command line is
+// still considered found. The filter applies before -top and -count.
+//
+// If the -max option is given, sizeof exits with status 1 if any printed type
+// is larger than the given number of bytes, reporting each such type on
+// standard error. The sizes themselves are still printed as usual.
+//
+// If the -check-align option is given, sizeof also checks that each field's
+// offset is a multiple of its natural alignment, the alignment of its type for
+// the target architecture, such as 4 for complex64 or, on 386, for int64.
+// It reports each misaligned field on standard error, as in
+// T.count at offset 4 is misaligned by 4 for its alignment 8, and exits with
+// status 1. Layouts computed by the Go compiler should always pass.
+//
+// If the -no-tail-pad option is given, sizeof also checks that no struct type
+// ends in padding: that its size is the end of its last field. It reports each
+// struct that does, as in T has 4 bytes of tail padding at offset 12, and exits
+// with status 1. Only struct types are checked, not arrays or other types.
+//
+// If the -diff option is given, sizeof compares two builds and prints only the
+// types whose sizes differ, as in Regexp 72 -> 80 (+8), along with types that
+// were added or removed. The two builds are either two packages given by -p,
+// as in -diff -p old/pkg,new/pkg, or one package built for two architectures
+// given by -arch, as in -diff -arch 386,amd64. With -f, sizeof also compares
+// field offsets, listing each type's fields after it. The differences are
+// sorted by type name. When there are differences, sizeof exits with status 1.
+//
+// If the -base option is given, sizeof compares the package as of a git
+// revision with the package in the working tree, as in -base HEAD~1, printing
+// the differences as -diff does (and implying -diff). It checks out the
+// revision in a temporary git worktree, which it removes when done, so the
+// current checkout is left alone. The package must be in a git repository.
+//
+// If the -watch option is given, sizeof keeps running after printing its results,
+// watching the package directories for changes to .go files. After each change,
+// it clears the screen and prints the results again. Interrupt sizeof to stop.
+//
+// Sizeof aligns the columns of its text output, padding the names so that
+// the sizes line up, and padding the field offsets printed by -f so that the
+// field types line up. To do so, it prints its results only once it has
+// finished. If the -raw option is given, sizeof prints each result as soon as
+// it is known, separating the columns by a single space, which may be easier
+// for scripts to parse.
+//
+// If a package has no types to measure, sizeof prints a warning, since it
+// would otherwise print nothing. If the -strict option is given, sizeof instead
+// treats such a package as an error and exits with a non-zero status.
+//
+// Sizeof exits with status 0 if it found every name on the command line,
+// status 1 if some names were not found, a type was larger than -max,
+// -check-align found a misaligned field, -no-tail-pad found tail padding,
+// or -diff found differences,
+// and status 2 if the command line was invalid or building a package failed.
+// Scripts can thus tell a misspelled name from a broken package.
 //
 // If the -v option is given, sizeof prints information about its internal operations.
 //
+// If the -dump-header option is given, sizeof prints the contents of each
+// go_asm.h file to standard error before parsing it. When a type is missing
+// from the output, the header shows which symbols the compiler did write.
+//
+// If the -timing option is given, sizeof prints to standard error how long each
+// phase of its work took: running ``go list'' and ``go build,'' parsing go_asm.h,
+// and type-checking, followed by the total time for each package.
+// The -v option prints the timings too.
+//
+// If the -n option is given, sizeof prints the go commands it would run
+// for each package, as a shell script with the environment variables it sets,
+// but runs nothing and prints no results. The arguments of the go build
+// command depend on what go list reports, so the script shows them for an
+// ordinary package that must be rebuilt, with comments noting the variations
+// and the stub files sizeof would write. For a pattern such as ./..., -n
+// prints only the go list command that expands it.
+//
+// If the -go option is given, sizeof runs the given go command, such as
+// go1.21.0 or /usr/local/go/bin/go, instead of the go found in the PATH.
+// Comparing the output of different Go toolchains shows how a new release
+// changes the layout of types, such as those in the runtime.
+//
+// If the -pkgdir option is given, sizeof measures the package in the given
+// directory, as if run in that directory. The directory need not be part of
+// a module or a GOPATH tree: sizeof builds a directory outside any module in
+// GOPATH mode, which makes it easy to measure types in scratch directories
+// or generated code. The -pkgdir option cannot be combined with -p.
+//
+// If the -tags option is given, sizeof passes it to ``go list'' and ``go build,''
+// so that files requiring those build tags are included.
+//
+// If the -build-flags option is given, sizeof splits it into arguments at spaces
+// and passes them to ``go build,'' as in -build-flags "-race -trimpath".
+// Arguments may be quoted, as in -build-flags "-gcflags='-N -l'". Sizeof adds
+// its own -gcflags to obtain go_asm.h; a -gcflags in -build-flags is combined
+// with those rather than replaced by them.
+//
+// If the -generate option is given, sizeof runs go generate ./... in each
+// package's directory before measuring it, so that types that exist only
+// after code generation are included. It runs go generate only once for each
+// directory, even with -arch or -watch. If go generate fails, sizeof reports
+// its output and does not measure the package.
+//
+// If the -tmpdir option is given, sizeof creates its temporary files in the
+// given directory instead of the system's default, as does the go command,
+// whose work directory is put there by setting GOTMPDIR. This helps where
+// $TMPDIR is small or read-only, as in some CI containers. The temporary
+// files are removed as usual.
+//
+// If the -trimpath option is given, sizeof builds hermetically: it passes
+// -trimpath to go build and runs the go commands with GOFLAGS=-trimpath, so
+// that flags set in GOFLAGS, in the environment or by go env -w, do not
+// affect the build.
+// Sizes do not depend on the checkout path in any case, but a build that
+// does not record it can be shared through the go build cache by checkouts
+// of the same code in different directories, and is the same on every machine.
+//
+// If the -mod option is given, sizeof passes it to the go commands it runs,
+// as in -mod=vendor, to control how modules are downloaded and verified.
+//
+// Sizeof caches the results of each build, keyed by the package's import path,
+// the names and modification times of its source files, the target GOOS and
+// GOARCH, the Go version, and the build flags, so that running sizeof again on an
+// unchanged package does not rebuild it. The cache does not track changes
+// to the package's dependencies. The -nocache option forces a fresh build.
+//
 // Sizeof builds the package using ``go build,'' so it uses the same operating system
 // and architecture as ``go build'' does. To find the size on a different system,
-// set GOOS and/or GOARCH.
+// set GOOS and/or GOARCH, or use the -goos and -goarch options, which set them
+// for the go commands that sizeof runs. The -arch option overrides -goarch.
+//
+// Some types change size depending on whether cgo is enabled. Sizeof uses the
+// go command's setting, which is usually off when cross-compiling. The -cgo
+// option sets CGO_ENABLED for the go commands, as in -cgo=0 or -cgo=1, and -v
+// reports whether cgo was enabled. A cross build with cgo enabled requires
+// a C cross compiler, named by CC.
+//
+// The go commands that sizeof runs inherit its environment, including GOFLAGS,
+// with the variables set by its options taking precedence, latest last:
+// first the environment; then -goos, -goarch, -cgo, and -trimpath's GOFLAGS;
+// then, for -pkgdir outside a module, GO111MODULE=off; and last the GOARCH
+// of each -arch build. The flags that sizeof passes on the go command line,
+// such as -mod and -build-flags, override the same flags in GOFLAGS, as usual
+// for the go command, except for -tags: the tags given to sizeof are added
+// to those set by -tags in GOFLAGS rather than replacing them. Settings made
+// by go env -w apply only where the environment does not override them.
+//
+// Sizeof reads default option values from a file named .sizeof.json in the
+// current directory or, failing that, the home directory, if one exists,
+// or from the file named by the -config option. The file holds a JSON object
+// mapping option names, without the leading dash, to values, as in
+//
+//	{"f": true, "sort": "size", "tags": "mybuild", "p": ["net/http", "net/url"]}
+//
+// A repeatable option such as -p takes a list of strings. Options given on
+// the command line override the file, and options that do not apply to the
+// command are ignored, so that sizeof consts works with a file setting -f.
+// The -v option reports which file was read.
+//
+// The rsc.io/sizeof/layout package provides the same information to Go programs.
 //
 // Example
 //
@@ -40,16 +633,34 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"go/token"
+	"go/types"
+	"io"
 	"io/ioutil"
 	"log"
+	"math"
+	"math/big"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"rsc.io/sizeof/layout"
 )
 
 var (
@@ -59,202 +670,2264 @@ var (
 )
 
 var (
-	flagConst   = flag.Bool("c", false, "show constant values")
-	flagField   = flag.Bool("f", false, "show field offsets")
-	flagPkg     = flag.String("p", "", "look up types in package named by `path`")
-	flagVerbose = flag.Bool("v", false, "print debugging information")
+	flagAlign        = flag.Bool("align", false, "show type alignment")
+	flagAll          = flag.Bool("all", false, "show both type sizes and constant values")
+	flagArch         = flag.String("arch", "", "compare sizes for comma-separated `list` of GOARCH values")
+	flagArrays       = flag.Bool("arrays", false, "with -f, show the element size and length of array fields")
+	flagBase         = flag.String("base", "", "print size differences from the package at git revision `rev`")
+	flagBenchmark    = flag.Int("benchmark", 0, "time `n` builds with each build strategy")
+	flagBiggestField = flag.Bool("biggest-field", false, "also print the largest field of each struct type")
+	flagBuildFlags   = flag.String("build-flags", "", "pass the space-separated `flags` to go build")
+	flagBuiltin      = flag.Bool("builtin", false, "show the sizes of built-in types such as slice and map")
+	flagCgo          = flag.String("cgo", "", "set CGO_ENABLED to `value` (0 or 1) for the go commands")
+	flagCheckAlign   = flag.Bool("check-align", false, "report fields not at a multiple of their natural alignment")
+	flagColor        = flag.String("color", "auto", "color padding-heavy types: auto, always, or never")
+	flagConfig       = flag.String("config", "", "read default flag values from `file` instead of .sizeof.json")
+	flagConst        = flag.Bool("c", false, "show constant values")
+	flagCost         = flag.Bool("cost", false, "also print the bytes each field adds, including padding")
+	flagCount        = flag.Bool("count", false, "print only the number of matching types, or constants with -c")
+	flagCSV          = flag.Bool("csv", false, "print results as comma-separated values")
+	flagDecHex       = flag.Bool("dechex", false, "print sizes and offsets in both decimal and hexadecimal")
+	flagDeep         = flag.Bool("deep", false, "estimate the memory referenced by each type")
+	flagDeepLen      = flag.Int64("deeplen", 1, "with -deep, assume slices, maps, and strings hold `n` elements")
+	flagDiff         = flag.Bool("diff", false, "print size differences between two packages or architectures")
+	flagDot          = flag.Bool("dot", false, "print a Graphviz graph of the types and the types they use")
+	flagDryRun       = flag.Bool("n", false, "print the go commands that would be run, but do not run them")
+	flagDumpHeader   = flag.Bool("dump-header", false, "print each go_asm.h file to standard error")
+	flagEmbed        = flag.Bool("embed", false, "with -f, show fields promoted from embedded structs")
+	flagExplain      = flag.Bool("explain", false, "explain each struct size as the sum of its fields and padding")
+	flagField        = flag.Bool("f", false, "show field offsets")
+	flagFieldsOnly   = flag.Bool("fields-only", false, "print field locations but not type sizes (implies -f)")
+	flagFlat         = flag.Bool("flat", false, "with -f, show only leaf fields, at their offsets in the outer type")
+	flagGenerate     = flag.Bool("generate", false, "run go generate ./... in each package directory first")
+	flagGo           = flag.String("go", "go", "run the go `command`")
+	flagGOARCH       = flag.String("goarch", "", "build for the architecture `arch` (sets GOARCH)")
+	flagGOOS         = flag.String("goos", "", "build for the operating system `os` (sets GOOS)")
+	flagHex          = flag.Bool("hex", false, "print integers in hexadecimal")
+	flagIface        = flag.String("iface", "", "also print the cost of storing each type in the interface `name`")
+	flagInterfaces   = flag.Bool("interfaces", false, "show method counts of interface types")
+	flagJSON         = flag.Bool("json", false, "print results as JSON")
+	flagJSONL        = flag.Bool("jsonl", false, "print results as JSON Lines, one object per line")
+	flagKind         = flag.Bool("kind", false, "also print the kind of each type's underlying type")
+	flagMap          = flag.Bool("map", false, "draw the memory layout of each struct")
+	flagMax          = flag.Int64("max", 0, "exit with status 1 if any type is larger than `size` bytes")
+	flagMethods      = flag.Bool("methods", false, "also list methods and whether their receivers are copied")
+	flagMinSize      = flag.Int64("min-size", 0, "print only types of at least `size` bytes")
+	flagMod          = flag.String("mod", "", "module download `mode` for go commands: mod, readonly, or vendor")
+	flagNames        = flag.String("names", "", "read names from `file`, one per line (- for standard input)")
+	flagNextFree     = flag.Bool("nextfree", false, "show size, alignment, and the offset following each type")
+	flagNoCache      = flag.Bool("nocache", false, "ignore cached results and rebuild the package")
+	flagNoTailPad    = flag.Bool("no-tail-pad", false, "report struct types with padding after their last field")
+	flagOutput       = flag.String("o", "", "write results to `file` (- for standard output)")
+	flagPad          = flag.Bool("pad", false, "show struct padding")
+	flagPkgdir       = flag.String("pkgdir", "", "measure the package in directory `dir`")
+	flagPrefix       = flag.String("prefix", "", "with -c, show only constants beginning with `prefix`")
+	flagPrefixLines  = flag.Bool("prefix-lines", false, "begin type, field, and constant lines with type:, field:, and const:")
+	flagPrefixMatch  = flag.Bool("prefix-match", false, "treat names as prefixes")
+	flagPtr          = flag.Bool("ptr", false, "show the number of pointer words in each type")
+	flagQuiet        = flag.Bool("q", false, "do not report names that cannot be found or print notes")
+	flagRaw          = flag.Bool("raw", false, "do not align output columns")
+	flagRecursive    = flag.Bool("recursive", false, "also print the types reachable from each type")
+	flagRegexp       = flag.Bool("r", false, "treat names as regular expressions")
+	flagRelativeTo   = flag.String("relative-to", "", "also print sizes as multiples of the size of `type`")
+	flagReorder      = flag.Bool("reorder", false, "suggest field order minimizing struct size")
+	flagCacheline    cachelineFlag
+	flagExclude      listFlag
+	flagExpr         multiFlag
+	flagPkg          listFlag
+	flagScan         = flag.Bool("scan", false, "also print the number of bytes the garbage collector scans in each type")
+	flagSizesOnly    = flag.Bool("sizes-only", false, "print type sizes but not field locations")
+	flagSort         = flag.String("sort", "name", "sort results by `order`: size, name, offset, or fields")
+	flagStrict       = flag.Bool("strict", false, "treat packages with no types as errors")
+	flagSum          = flag.Bool("sum", false, "print a summary of the type sizes")
+	flagSymbols      = flag.Bool("symbols", false, "also print the go_asm.h symbol for each size and offset")
+	flagTags         = flag.String("tags", "", "build with the comma-separated `list` of build tags")
+	flagTemplate     = flag.String("template", "", "print each type using the text/template `tmpl`")
+	flagTiming       = flag.Bool("timing", false, "print how long each phase takes")
+	flagTmpdir       = flag.String("tmpdir", "", "create temporary files, including the go build work directory, in `dir`")
+	flagTop          = flag.Int("top", 0, "print only the `n` largest types")
+	flagTotalPad     = flag.Bool("total-pad", false, "print the total padding in all struct types, and the types with the most")
+	flagTrimpath     = flag.Bool("trimpath", false, "build with -trimpath, ignoring GOFLAGS from the environment")
+	flagType         = flag.Bool("t", false, "with -f, show field types")
+	flagVerbose      = flag.Bool("v", false, "print debugging information")
+	flagWatch        = flag.Bool("watch", false, "rerun whenever the package sources change")
+	flagWords        = flag.Bool("words", false, "also print sizes in machine words")
+
+	want   []string
+	wantRE []*regexp.Regexp // compiled want, for -r
+
+	// pathNames maps an import path to the names given after
+	// the -p flag that named it, which are sought only in that package.
+	pathNames = make(map[string][]string)
+
+	excludeRE []*regexp.Regexp        // compiled -exclude, for -r
+	found     = make(map[string]bool) // names in want that were matched
+
+	// generic records the generic types in the loaded packages.
+	generic = make(map[string]bool)
+
+	// notTypes records the names in want that the loaded packages
+	// declare as a func, var, or const rather than a type.
+	notTypes = make(map[string]string)
+
+	// instanceRE matches a name that instantiates a generic type,
+	// such as List[int]; sizeof measures it as if given by -expr.
+	instanceRE = regexp.MustCompile(`^[\pL_][\pL\pN_]*\[.+\]$`)
+
+	stdout *bufio.Writer // destination for results; see -o
+)
+
+func init() {
+	flag.Var(&flagCacheline, "cacheline", "with -f, mark cache lines of `size` bytes (default 64)")
+	flag.Var(&flagExclude, "exclude", "omit the types named in `list` (comma-separated; repeatable)")
+	flag.Var(&flagExpr, "expr", "print the size of the type `expression` (repeatable)")
+	flag.Var(&flagPkg, "p", "look up types in package named by `path` (comma-separated list; repeatable)")
+}
+
+// buildFlags holds the -build-flags list, split into arguments.
+var buildFlags []string
+
+// splitArgs splits s into space-separated arguments.
+// An argument may be quoted with single or double quotes,
+// as in -gcflags='-N -l', to include spaces.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	quote := rune(0)
+	for _, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// A listFlag is a flag.Value holding a list of strings.
+// Each use of the flag appends its comma-separated values to the list.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(s string) error {
+	for _, x := range strings.Split(s, ",") {
+		if x != "" {
+			*l = append(*l, x)
+		}
+	}
+	return nil
+}
 
-	want []string
+// A multiFlag is a flag.Value holding a list of strings,
+// one for each use of the flag.
+type multiFlag []string
+
+func (m *multiFlag) String() string { return strings.Join(*m, " ") }
+
+func (m *multiFlag) Set(s string) error {
+	*m = append(*m, s)
+	return nil
+}
+
+// Exit statuses.
+const (
+	exitNotFound = 1 // some names not found, a type over -max, a -check-align failure, or -diff differences
+	exitError    = 2 // invalid usage, or the build or the go command failed
 )
 
 func usage() {
-	fmt.Fprintf(os.Stderr, "usage: sizeof [-c] [-f] [-p path] [type...]\n")
-	fmt.Fprintf(os.Stderr, "options:\n")
-	flag.PrintDefaults()
-	os.Exit(2)
+	printSubcommands()
+	fmt.Fprintf(os.Stderr, "exit status:\n")
+	fmt.Fprintf(os.Stderr, "  0\tall names found\n")
+	fmt.Fprintf(os.Stderr, "  1\tsome names not found, a type larger than -max, a field misaligned for -check-align, tail padding for -no-tail-pad, or -diff found differences\n")
+	fmt.Fprintf(os.Stderr, "  2\tinvalid usage, or a build or go command error\n")
+	os.Exit(exitError)
+}
+
+// fatal and fatalf are like log.Fatal and log.Fatalf
+// but exit with status exitError.
+func fatal(args ...interface{}) {
+	log.Print(args...)
+	removeOutput()
+	os.Exit(exitError)
+}
+
+func fatalf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+	removeOutput()
+	os.Exit(exitError)
 }
 
 func main() {
 	log.SetFlags(0)
 	log.SetPrefix("sizeof: ")
 	flag.Usage = usage
-	flag.Parse()
-	want = flag.Args()
-
-	// Resolve -p option.
-	dir := "."
-	if *flagPkg != "" {
-		out, err := exec.Command("go", "list", "-f", "{{.Dir}}", *flagPkg).CombinedOutput()
+	want = parseArgs()
+	if *flagNames != "" {
+		names, err := readNames(*flagNames)
 		if err != nil {
-			if len(out) > 0 {
-				log.Fatalf("%s", out)
+			fatal(err)
+		}
+		want = append(want, names...)
+	}
+	if *flagRegexp && *flagPrefixMatch {
+		fatal("cannot use -r with -prefix-match")
+	}
+	if *flagRegexp {
+		for _, names := range pkgNames {
+			compileWant(names)
+		}
+		wantRE = compileWant(want)
+		for _, x := range flagExclude {
+			re, err := regexp.Compile(x)
+			if err != nil {
+				fatal(err)
+			}
+			excludeRE = append(excludeRE, re)
+		}
+	} else if !*flagPrefixMatch {
+		splitQualified()
+		for _, x := range want {
+			if instanceRE.MatchString(x) {
+				flagExpr = append(flagExpr, x)
 			}
-			log.Fatalf("go list: %v", err)
 		}
-		dir = strings.TrimSpace(string(out))
+	}
+	if *flagJSONL {
+		// -jsonl collects the same objects as -json
+		// and differs only in how it prints them.
+		*flagJSON = true
+	}
+	removeTempOnInterrupt()
+	if *flagVerbose && !*flagDryRun {
+		reportGo()
+	}
+	if *flagVerbose && *flagTags != "" {
+		log.Printf("using build tags %s", *flagTags)
 	}
 
-	// Find information about package.
-	cmd := exec.Command("go", "list", "-f", "{{.ImportPath}}\n{{.Stale}}\n{{.SFiles}}\n{{.Name}}")
-	cmd.Dir = dir
-	outb, err := cmd.CombinedOutput()
-	if err != nil {
-		if len(outb) > 0 {
-			log.Fatalf("%s", outb)
+	if *flagWatch && *flagOutput != "" && *flagOutput != "-" {
+		fatal("cannot use -watch with -o")
+	}
+	if *flagBase != "" {
+		*flagDiff = true
+	}
+	if *flagDryRun && (*flagDiff || *flagWatch || *flagBenchmark > 0) {
+		fatal("cannot use -n with -diff, -base, -watch, or -benchmark")
+	}
+	if *flagHex && *flagDecHex {
+		fatal("cannot use -hex with -dechex")
+	}
+	if *flagAll && (*flagConst || *flagCSV || *flagArch != "" || *flagDiff) {
+		fatal("cannot use -all with -c, -csv, -arch, or -diff")
+	}
+	if *flagBuiltin && (len(flagPkg) > 0 || len(flagExpr) > 0) {
+		fatal("cannot use -builtin with -p or -expr")
+	}
+	if *flagMinSize < 0 {
+		fatalf("invalid -min-size %d: must not be negative", *flagMinSize)
+	}
+	if *flagTop < 0 {
+		fatalf("invalid -top %d: must not be negative", *flagTop)
+	}
+	if *flagTop > 0 && (*flagConst || *flagAll || *flagArch != "" || *flagDiff || *flagInterfaces) {
+		fatal("cannot use -top with -c, -all, -arch, -diff, or -interfaces")
+	}
+	if *flagDot && (*flagJSON || *flagCSV || *flagConst || *flagAll || *flagArch != "" || *flagDiff) {
+		fatal("cannot use -dot with -json, -csv, -c, -all, -arch, or -diff")
+	}
+	if *flagCount && (*flagJSON || *flagCSV || *flagDot || *flagAll || *flagArch != "" || *flagDiff || *flagTop > 0 || *flagTemplate != "" || *flagSum || *flagTotalPad) {
+		fatal("cannot use -count with -json, -csv, -dot, -all, -arch, -diff, -top, -template, -sum, or -total-pad")
+	}
+	if *flagRelativeTo != "" && (*flagCSV || *flagDot || *flagConst || *flagDiff || *flagArch != "") {
+		fatal("cannot use -relative-to with -csv, -dot, -c, -diff, or -arch")
+	}
+	if *flagIface != "" && (*flagCSV || *flagDot || *flagConst || *flagDiff || *flagArch != "" || *flagBuiltin) {
+		fatal("cannot use -iface with -csv, -dot, -c, -diff, -arch, or -builtin")
+	}
+	if *flagTotalPad && (*flagJSON || *flagCSV || *flagDot || *flagConst || *flagDiff || *flagArch != "") {
+		fatal("cannot use -total-pad with -json, -csv, -dot, -c, -diff, or -arch")
+	}
+	if *flagPrefixLines && (*flagJSON || *flagCSV || *flagDot || *flagTemplate != "" || *flagArch != "" || *flagDiff || *flagCount) {
+		fatal("cannot use -prefix-lines with -json, -csv, -dot, -template, -arch, -diff, or -count")
+	}
+	if *flagExplain && (*flagJSON || *flagCSV) {
+		fatal("cannot use -explain with -json or -csv")
+	}
+	if *flagFlat && *flagEmbed {
+		fatal("cannot use -flat with -embed")
+	}
+	if *flagFieldsOnly && *flagSizesOnly {
+		fatal("cannot use -fields-only with -sizes-only")
+	}
+	if *flagFieldsOnly {
+		*flagField = true
+	}
+	if *flagTemplate != "" {
+		if *flagJSON || *flagCSV || *flagDot || *flagConst || *flagAll || *flagArch != "" || *flagDiff {
+			fatal("cannot use -template with -json, -csv, -dot, -c, -all, -arch, or -diff")
+		}
+		t, err := template.New("sizeof").Parse(*flagTemplate)
+		if err != nil {
+			fatalf("invalid -template: %v", err)
 		}
-		log.Fatalf("go list: %v", err)
+		outTemplate = t
+	}
+	if *flagCSV && *flagJSON {
+		fatal("cannot use -csv with -json")
 	}
-	lines := strings.Split(strings.TrimSpace(string(outb)), "\n")
-	if len(lines) < 4 {
-		log.Fatalf("go list: unexpected output")
+	if *flagCSV && *flagDiff {
+		fatal("cannot use -csv with -diff")
 	}
-	pkg := lines[0]
-	stale := lines[1] == "true"
-	haveSFiles := lines[2] != "[]"
-	packageName := lines[3]
 
-	// Figure out how to get the asm header file.
-	var tmp *os.File
-	args := []string{"build"}
-	if haveSFiles {
-		// Go command already writes asmhdr file. Use that one.
-		if *flagVerbose {
-			log.Print("package has .s files; using -work")
+	if *flagBuildFlags != "" {
+		list, err := splitArgs(*flagBuildFlags)
+		if err != nil {
+			fatalf("invalid -build-flags: %v", err)
 		}
-		args = append(args, "-work")
-	} else {
-		// Add -asmhdr explicitly.
-		// This is used for every package being built,
-		// but ours is built last and only after all the others,
-		// so the repeated smashing of the file before then
-		// is okay.
-		if *flagVerbose {
-			log.Print("package has no .s files; using -asmhdr")
+		buildFlags = list
+	}
+	if *flagTrimpath {
+		buildFlags = append(buildFlags, "-trimpath")
+	}
+
+	switch *flagCgo {
+	case "", "0", "1":
+		// ok
+	default:
+		fatalf("invalid -cgo %q: must be 0 or 1", *flagCgo)
+	}
+
+	switch *flagMod {
+	case "", "mod", "readonly", "vendor":
+		// ok
+	default:
+		fatalf("invalid -mod %q: must be mod, readonly, or vendor", *flagMod)
+	}
+
+	switch *flagSort {
+	case "", "size", "name", "offset", "fields":
+		// ok
+	default:
+		fatalf("invalid -sort %q: must be size, name, offset, or fields", *flagSort)
+	}
+
+	if *flagTmpdir != "" {
+		if fi, err := os.Stat(*flagTmpdir); err != nil {
+			fatalf("invalid -tmpdir: %v", err)
+		} else if !fi.IsDir() {
+			fatalf("invalid -tmpdir: %s is not a directory", *flagTmpdir)
 		}
-		f, err := ioutil.TempFile("", "rsc-io-sizeof-")
+		abs, err := filepath.Abs(*flagTmpdir)
 		if err != nil {
-			log.Fatal(err)
+			fatalf("invalid -tmpdir: %v", err)
 		}
-		tmp = f
-		args = append(args, "-gcflags", "-asmhdr="+tmp.Name())
+		*flagTmpdir = abs
 	}
 
-	// Figure out how to force the build of the package.
-	cleanup := ""
-	if !stale {
-		cleanup = filepath.Join(dir, "xxx_rsc_io_sizeof_tmp_.go")
-		if *flagVerbose {
-			log.Printf("package is not stale; writing %v", cleanup)
+	// Open the -o file only once the flags are known to be valid,
+	// before doing any work.
+	if *flagOutput != "" && *flagOutput != "-" {
+		createOutput(*flagOutput)
+		setColor(outFile)
+	} else {
+		setColor(os.Stdout)
+	}
+	var w io.Writer = os.Stdout
+	if outFile != nil {
+		w = outFile
+	}
+	if !*flagRaw && !*flagJSON && !*flagCSV && !*flagDot && *flagTemplate == "" && *flagArch == "" && !*flagDryRun {
+		alignOut = &aligner{w: w}
+		w = alignOut
+	}
+	stdout = bufio.NewWriter(w)
+
+	if *flagPkgdir != "" {
+		if len(flagPkg) > 0 || *flagBuiltin {
+			fatal("cannot use -pkgdir with -p or -builtin")
 		}
-		err := ioutil.WriteFile(cleanup, []byte("package "+packageName), 0666)
-		if err != nil {
-			if *flagVerbose {
-				log.Printf("write failed: %v", err)
-			}
-			args = append(args, "-a")
+		if err := checkPkgdir(*flagPkgdir); err != nil {
+			fatal(err)
 		}
 	}
 
-	// Build.
-	if *flagVerbose {
-		log.Printf("go %v", strings.Join(args, " "))
+	paths, err := expandPackages(flagPkg)
+	if err != nil {
+		fatal(err)
+	}
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+	var status int
+	if *flagBenchmark > 0 {
+		status = benchmark(paths, *flagBenchmark)
+	} else {
+		status = run(paths)
+	}
+	if *flagWatch {
+		watch(paths)
+	}
+	if status == exitError {
+		removeOutput()
+	} else {
+		commitOutput()
+	}
+	os.Exit(status)
+}
+
+// outFile is the temporary file holding the results for -o,
+// which commitOutput renames to the -o file once they are complete,
+// so that a failed run leaves any existing -o file unchanged.
+var outFile *os.File
+
+// createOutput creates outFile, in the same directory as the -o file name
+// so that it can be renamed to it. The results get the permissions of the
+// file they replace, if any.
+func createOutput(name string) {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp*")
+	if err != nil {
+		fatal(err)
+	}
+	outFile = f
+	perm := os.FileMode(0644)
+	if fi, err := os.Stat(name); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	if err := f.Chmod(perm); err != nil {
+		fatal(err)
+	}
+}
+
+// commitOutput closes outFile and renames it to the -o file.
+func commitOutput() {
+	if outFile == nil {
+		return
+	}
+	f := outFile
+	outFile = nil
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		fatal(err)
+	}
+	if err := os.Rename(f.Name(), *flagOutput); err != nil {
+		os.Remove(f.Name())
+		fatal(err)
+	}
+}
+
+// removeOutput removes outFile, leaving the -o file as it was.
+func removeOutput() {
+	if outFile != nil {
+		outFile.Close()
+		os.Remove(outFile.Name())
+		outFile = nil
 	}
-	cmd = exec.Command("go", args...)
+}
+
+// pkgdirEnv holds the environment needed to build the -pkgdir directory.
+var pkgdirEnv []string
+
+// checkPkgdir checks that dir, the -pkgdir directory, holds Go source files.
+// If dir is not in a module, checkPkgdir arranges for the go commands
+// to build it in GOPATH mode, so that scratch directories can be measured.
+func checkPkgdir(dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("-pkgdir %s: not a directory", dir)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, file := range files {
+		if !strings.HasSuffix(file, "_test.go") {
+			n++
+		}
+	}
+	if n == 0 {
+		return fmt.Errorf("-pkgdir %s: no Go source files", dir)
+	}
+	if *flagDryRun {
+		// Print the check rather than run it.
+		fmt.Fprintf(stdout, "# GO111MODULE=off if go env GOMOD in %s reports no module\n", dir)
+		return nil
+	}
+	cmd := exec.Command(*flagGo, "env", "GOMOD")
 	cmd.Dir = dir
-	outb, err = cmd.CombinedOutput()
-	if cleanup != "" {
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("-pkgdir %s: go env: %v", dir, err)
+	}
+	if gomod := strings.TrimSpace(string(out)); gomod == "" || gomod == os.DevNull {
 		if *flagVerbose {
-			log.Printf("rm %v", cleanup)
+			log.Printf("%s is not in a module; using GO111MODULE=off", dir)
 		}
-		os.Remove(cleanup)
+		pkgdirEnv = []string{"GO111MODULE=off"}
 	}
-	out := string(outb)
-	workdir := ""
-	if strings.HasPrefix(out, "WORK=") {
-		i := strings.Index(out, "\n")
-		if i >= 0 {
-			workdir = out[len("WORK="):i]
-			out = out[i+1:]
-		}
+	return nil
+}
+
+// reportGo prints the location and version of the go command
+// named by -go, for -v.
+func reportGo() {
+	path, err := exec.LookPath(*flagGo)
+	if err != nil {
+		log.Printf("cannot find go command: %v", err)
+		return
 	}
+	out, err := exec.Command(path, "version").Output()
 	if err != nil {
-		if workdir != "" {
-			os.RemoveAll(workdir)
-		}
-		if len(out) > 0 {
-			log.Fatalf("%s", out)
-		}
-		log.Fatalf("go build: %v", err)
+		log.Printf("using go command %s", path)
+		return
 	}
+	log.Printf("using go command %s (%s)", path, strings.TrimSpace(string(out)))
+}
 
+// readNames returns the names listed in file, one per line,
+// or in standard input if file is -.
+// Blank lines and lines beginning with # are ignored.
+func readNames(file string) ([]string, error) {
 	var data []byte
-	if haveSFiles {
-		if workdir == "" {
-			log.Fatal("go build: cannot find work directory")
-		}
-		// Parse go_asm.h file left in work directory.
-		hdr := workdir + "/" + pkg + "/_obj/go_asm.h"
-		data, err = ioutil.ReadFile(hdr)
-		os.RemoveAll(workdir)
+	var err error
+	if file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
 	} else {
-		// Parse go_asm.h file written to f.
-		data, err = ioutil.ReadFile(tmp.Name())
-		tmp.Close()
-		os.Remove(tmp.Name())
+		data, err = ioutil.ReadFile(file)
 	}
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-
-	inType := ""
-	match := false
+	var names []string
 	for _, line := range strings.Split(string(data), "\n") {
-		f := strings.Fields(line)
-		if len(f) != 3 || f[0] != "#define" {
-			continue
-		}
-		val := f[2]
-		if *flagConst {
-			if strings.HasPrefix(f[1], "const_") {
-				name := strings.TrimPrefix(f[1], "const_")
-				if matchName(name) {
-					fmt.Printf("%s %s\n", name, val)
-				}
-			}
-			continue
-		}
-		if strings.HasSuffix(f[1], "__size") {
-			inType = strings.TrimSuffix(f[1], "__size")
-			match = matchName(inType)
-			if match {
-				fmt.Printf("%s %s\n", inType, val)
-			}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-		if match && *flagField && strings.HasPrefix(f[1], inType+"_") {
-			fmt.Printf("%s.%s %s\n", inType, f[1][len(inType)+1:], val)
-		}
+		names = append(names, line)
 	}
+	return names, nil
+}
 
+// run prints the information for the packages named by paths
+// and returns the exit status.
+func run(paths []string) int {
 	status := 0
+	if *flagDiff {
+		changed, err := diff(paths)
+		if err != nil {
+			log.Print(err)
+			status = exitError
+		} else if changed {
+			status = exitNotFound
+		}
+		paths = nil
+	}
+	global, globalRE := want, wantRE
+	for _, path := range paths {
+		scoped := pathNames[path]
+		if len(scoped) > 0 {
+			want = append(global[:len(global):len(global)], scoped...)
+			if *flagRegexp {
+				wantRE = append(globalRE[:len(globalRE):len(globalRE)], compileWant(scoped)...)
+			}
+		}
+		if err := sizeof(path, len(paths) > 1); err != nil {
+			if path != "" {
+				log.Printf("%s: %v", path, err)
+			} else {
+				log.Print(err)
+			}
+			status = exitError
+		}
+		for _, name := range scoped {
+			if !found[name] && !*flagQuiet && !excluded(name) {
+				if *flagRegexp {
+					log.Printf("cannot find type matching %s in %s", name, path)
+				} else if kind := notTypes[name]; kind != "" {
+					log.Printf("%s is a %s, not a type", qualify(path, name), kind)
+				} else if path == "" {
+					log.Printf("cannot find type %s", name)
+				} else {
+					log.Printf("cannot find type %s in %s", name, path)
+				}
+				if status == 0 {
+					status = exitNotFound
+				}
+			}
+			if !isGlobal(name, global) {
+				delete(found, name)
+			}
+		}
+		want, wantRE = global, globalRE
+	}
+	if *flagDryRun {
+		flushOutput()
+		return status
+	}
+	if *flagTop > 0 {
+		printTop()
+	}
+	if *flagCount {
+		fmt.Fprintf(stdout, "%d\n", matchCount)
+	}
+	if *flagJSON {
+		if *flagJSONL {
+			printJSONLines()
+		} else {
+			printJSON(jsonDocument())
+		}
+	} else if *flagCSV {
+		flushCSV()
+	} else if *flagDot {
+		dotOut.print()
+	} else if *flagSum && !*flagConst && !*flagDiff && *flagArch == "" {
+		summary.print()
+	}
+	if *flagTotalPad && !*flagJSON && !*flagCSV && !*flagDot {
+		padTotals.print()
+	}
+	flushOutput()
+
+	if (tooBig || misaligned || tailPadded) && status == 0 {
+		status = exitNotFound
+	}
 	for _, name := range want {
-		if name != "" {
-			log.Printf("cannot find type %s", name)
-			status = 1
+		if !found[name] && !*flagQuiet && !excluded(name) {
+			if *flagRegexp {
+				log.Printf("cannot find type matching %s", name)
+			} else if kind := notTypes[name]; kind != "" {
+				log.Printf("%s is a %s, not a type", name, kind)
+			} else if generic[name] {
+				log.Printf("cannot find type %s: %s is generic; give its type arguments, as in %s[int]", name, name, name)
+			} else {
+				log.Printf("cannot find type %s", name)
+			}
+			if status == 0 {
+				status = exitNotFound
+			}
 		}
 	}
-	os.Exit(status)
+	return status
+}
+
+// isGlobal reports whether name is in global,
+// the list of names sought in every package.
+func isGlobal(name string, global []string) bool {
+	for _, x := range global {
+		if x == name {
+			return true
+		}
+	}
+	return false
+}
+
+// compileWant returns the compiled regular expressions in names, for -r.
+func compileWant(names []string) []*regexp.Regexp {
+	var list []*regexp.Regexp
+	for _, x := range names {
+		re, err := regexp.Compile(x)
+		if err != nil {
+			fatal(err)
+		}
+		list = append(list, re)
+	}
+	return list
+}
+
+// flushOutput writes the buffered results.
+func flushOutput() {
+	if err := stdout.Flush(); err != nil {
+		fatal(err)
+	}
+	if alignOut != nil {
+		if err := alignOut.Flush(); err != nil {
+			fatal(err)
+		}
+	}
+}
+
+// expandPackages expands the package patterns in the -p list,
+// such as ./... or std, into the import paths they match.
+// Plain import paths are returned unchanged.
+// The names given after a pattern on the command line
+// are recorded in pathNames for each path it matches.
+func expandPackages(list []string) ([]string, error) {
+	var paths []string
+	for _, path := range list {
+		if !strings.Contains(path, "...") && path != "all" && path != "std" && path != "cmd" {
+			paths = append(paths, path)
+			if names := pkgNames[path]; len(names) > 0 {
+				pathNames[path] = append(pathNames[path], names...)
+			}
+			continue
+		}
+		matched, err := layout.Expand(path, options(nil))
+		if errors.Is(err, layout.ErrDryRun) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(matched) == 0 {
+			log.Printf("warning: %q matched no packages", path)
+		}
+		paths = append(paths, matched...)
+		if names := pkgNames[path]; len(names) > 0 {
+			for _, m := range matched {
+				pathNames[m] = append(pathNames[m], names...)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// options returns the layout options for the command line,
+// with the additional environment variables in env,
+// such as GOARCH=386.
+func options(env []string) layout.Options {
+	// Variables in env come last, so that they
+	// override -goos and -goarch.
+	var list []string
+	if *flagGOOS != "" {
+		list = append(list, "GOOS="+*flagGOOS)
+	}
+	if *flagGOARCH != "" {
+		list = append(list, "GOARCH="+*flagGOARCH)
+	}
+	if *flagCgo != "" {
+		list = append(list, "CGO_ENABLED="+*flagCgo)
+	}
+	if *flagTrimpath {
+		// An empty GOFLAGS would not override one set by go env -w.
+		list = append(list, "GOFLAGS=-trimpath")
+	}
+	list = append(list, pkgdirEnv...)
+	list = append(list, env...)
+	opts := layout.Options{
+		Dir:        *flagPkgdir,
+		Env:        list,
+		Go:         *flagGo,
+		Tags:       *flagTags,
+		Mod:        *flagMod,
+		Exprs:      flagExpr,
+		BuildFlags: buildFlags,
+		Generate:   *flagGenerate,
+		TypeCheck:  needTypes(),
+		NoCache:    *flagNoCache,
+		TempDir:    *flagTmpdir,
+	}
+	if *flagDryRun {
+		opts.DryRun = stdout
+	}
+	if *flagVerbose {
+		opts.Logf = log.Printf
+	}
+	if *flagDumpHeader {
+		opts.Header = os.Stderr
+	}
+	if *flagVerbose || *flagTiming {
+		opts.Timef = func(phase string, d time.Duration) {
+			log.Printf("timing: %s %v", phase, d.Round(time.Microsecond))
+		}
+	}
+	return opts
+}
+
+// sizeof prints the information for the package named by the import path,
+// or for the package in the current directory if path is empty.
+// If qualified is set, each printed name is qualified by the package's
+// import path, as reported by the go command, rather than by path,
+// which may be relative, as in ./sub.
+func sizeof(path string, qualified bool) error {
+	if *flagVerbose || *flagTiming {
+		start := time.Now()
+		defer func() {
+			name := path
+			if name == "" {
+				name = "."
+			}
+			log.Printf("timing: total for %s %v", name, time.Since(start).Round(time.Microsecond))
+		}()
+	}
+	if *flagArch != "" {
+		archs := strings.Split(*flagArch, ",")
+		var ps []*layout.Package
+		for _, arch := range archs {
+			p, err := load(path, options([]string{"GOARCH=" + arch}))
+			if errors.Is(err, layout.ErrDryRun) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("GOARCH=%s: %v", arch, err)
+			}
+			ps = append(ps, p)
+		}
+		if *flagDryRun {
+			return nil
+		}
+		if err := checkTypes(ps[0]); err != nil {
+			return err
+		}
+		pkg := ""
+		if qualified {
+			pkg = ps[0].ImportPath
+		}
+		addGeneric(ps[0])
+		printArchTable(pkg, archs, ps)
+		addNotTypes(ps[0])
+		return nil
+	}
+
+	p, err := load(path, options(nil))
+	if errors.Is(err, layout.ErrDryRun) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkTypes(p); err != nil {
+		return err
+	}
+	pkg := ""
+	if qualified {
+		pkg = p.ImportPath
+	}
+	if *flagRelativeTo != "" {
+		baseline = p.Lookup(*flagRelativeTo)
+		if baseline == nil {
+			return fmt.Errorf("cannot find -relative-to type %s", *flagRelativeTo)
+		}
+		if baseline.Size == 0 {
+			return fmt.Errorf("-relative-to type %s has size 0", *flagRelativeTo)
+		}
+	}
+	if *flagIface != "" {
+		if err := lookupIface(p); err != nil {
+			return err
+		}
+	}
+	addGeneric(p)
+	printPackage(pkg, p)
+	addNotTypes(p)
+	return nil
+}
+
+// addNotTypes records the names in want that p declares as a func, var,
+// or const, so that not finding them as types can be explained.
+// Only when a name was not found does it type-check p to look.
+func addNotTypes(p *layout.Package) {
+	if *flagRegexp || *flagPrefixMatch || *flagConst || *flagBuiltin {
+		return
+	}
+	var missing []string
+	for _, name := range want {
+		if !found[name] && !generic[name] && notTypes[name] == "" && token.IsIdentifier(name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	if err := layout.TypeCheck(p, options(nil)); err != nil {
+		if *flagVerbose {
+			log.Printf("%s: %v", p.ImportPath, err)
+		}
+		return
+	}
+	for _, name := range missing {
+		switch p.TypesPackage.Scope().Lookup(name).(type) {
+		case *types.Func:
+			notTypes[name] = "func"
+		case *types.Var:
+			notTypes[name] = "var"
+		case *types.Const:
+			notTypes[name] = "const"
+		}
+	}
+}
+
+// addGeneric records the generic types in p, so that a name
+// that cannot be found because it is generic can be explained.
+func addGeneric(p *layout.Package) {
+	for _, name := range p.Generic {
+		generic[name] = true
+	}
+}
+
+// checkTypes diagnoses a package p with no types to measure,
+// which would otherwise print nothing at all. With -strict it returns
+// an error; otherwise it prints a warning and returns nil.
+// A package with no types is expected with -c.
+func checkTypes(p *layout.Package) error {
+	if len(p.Types) > 0 || *flagConst {
+		return nil
+	}
+	msg := "no measurable types: the compiler reported no type sizes"
+	if *flagStrict {
+		return errors.New(msg)
+	}
+	log.Printf("warning: %s: %s", p.ImportPath, msg)
+	return nil
+}
+
+// load returns the layout information for the package named by path,
+// or the built-in types if -builtin was given.
+func load(path string, opts layout.Options) (*layout.Package, error) {
+	if *flagBuiltin {
+		return layout.Builtins(opts)
+	}
+	p, err := layout.Sizes(path, opts)
+	if err == nil && jsonGOOS == "" {
+		jsonGOOS, jsonGOARCH = p.GOOS, p.GOARCH
+	}
+	if err == nil && !*flagQuiet {
+		// Recompiling with a stub file is routine and cheap,
+		// but rebuilding every dependency with -a is not.
+		switch p.Forced {
+		case layout.ForcedStub:
+			if *flagVerbose {
+				log.Printf("note: %s is up to date; recompiled it to obtain go_asm.h", p.ImportPath)
+			}
+		case layout.ForcedAll:
+			log.Printf("note: %s is up to date and cannot be modified; rebuilt it and all its dependencies with go build -a to obtain go_asm.h", p.ImportPath)
+		}
+	}
+	return p, err
+}
+
+// qualify returns name qualified by the package pkg, if any.
+func qualify(pkg, name string) string {
+	if pkg == "" {
+		return name
+	}
+	return pkg + "." + name
+}
+
+// matchType reports whether the type t should be printed.
+// When -expr is given, sizeof prints the expressions and only
+// those types named on the command line.
+func matchType(t *layout.Type) bool {
+	if t.Expr != "" {
+		found[t.Expr] = true
+		return true
+	}
+	if len(flagExpr) > 0 && len(want) == 0 {
+		return false
+	}
+	return matchName(t.Name) && !excluded(t.Name)
+}
+
+// matchConst reports whether the constant c should be printed:
+// whether it has the -prefix prefix, matches the command line,
+// and is not excluded.
+func matchConst(c *layout.Const) bool {
+	return strings.HasPrefix(c.Name, *flagPrefix) && matchName(c.Name) && !excluded(c.Name)
+}
+
+// excluded reports whether name is excluded by -exclude.
+// With -r, the excluded names are regular expressions,
+// and with -prefix-match, they are prefixes.
+func excluded(name string) bool {
+	if excludeRE != nil {
+		for _, re := range excludeRE {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, x := range flagExclude {
+		if name == x || *flagPrefixMatch && strings.HasPrefix(name, x) {
+			return true
+		}
+	}
+	return false
 }
 
 func matchName(name string) bool {
 	if len(want) == 0 {
 		return true
 	}
-	for i, x := range want {
+	if wantRE != nil {
+		match := false
+		for i, re := range wantRE {
+			if re.MatchString(name) {
+				found[want[i]] = true
+				match = true
+			}
+		}
+		return match
+	}
+	if *flagPrefixMatch {
+		match := false
+		for _, x := range want {
+			if strings.HasPrefix(name, x) {
+				found[x] = true
+				match = true
+			}
+		}
+		return match
+	}
+	for _, x := range want {
 		if name == x {
-			want[i] = ""
+			found[x] = true
 			return true
 		}
 	}
 	return false
 }
+
+// removeTempOnInterrupt arranges for the temporary files
+// to be removed when sizeof is interrupted.
+func removeTempOnInterrupt() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		layout.Cleanup()
+		removeOutput()
+		if *flagWatch {
+			// Interrupting is the usual way to stop -watch.
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}()
+}
+
+// printPackage prints the types or constants from p
+// that match the command line.
+// If pkg is not empty, it qualifies each printed name.
+func printPackage(pkg string, p *layout.Package) {
+	if *flagConst {
+		printPackageConsts(pkg, p)
+		return
+	}
+
+	if *flagAll && !*flagJSON {
+		fmt.Fprintf(stdout, "# type sizes\n")
+	}
+	if *flagVerbose && (*flagAlign || *flagNextFree) {
+		log.Printf("computing alignment for GOARCH=%s as the largest field alignment", p.GOARCH)
+	}
+	var list []*layout.Type
+	for _, t := range p.Types {
+		if matchType(t) && t.Size >= *flagMinSize {
+			list = append(list, t)
+		}
+	}
+	if *flagCount {
+		matchCount += len(list)
+		return
+	}
+	sortTypes(list)
+	if *flagTop > 0 {
+		for _, t := range list {
+			topTypes = append(topTypes, topType{pkg, t, p.PtrSize, baseline, ifaceType, ifacePkg})
+		}
+		return
+	}
+	printTypes(pkg, list, p.PtrSize)
+	if *flagInterfaces {
+		printInterfaces(pkg, p.Interfaces)
+	}
+	if *flagAll {
+		if !*flagJSON {
+			fmt.Fprintf(stdout, "# constants\n")
+		}
+		printPackageConsts(pkg, p)
+	}
+}
+
+// printPackageConsts prints the constants from p that match the command line.
+// If pkg is not empty, it qualifies each printed name.
+func printPackageConsts(pkg string, p *layout.Package) {
+	var consts []*layout.Const
+	for _, c := range p.Consts {
+		if matchConst(c) {
+			consts = append(consts, c)
+		}
+	}
+	if *flagCount {
+		matchCount += len(consts)
+		return
+	}
+	sortConsts(consts)
+	printConsts(pkg, consts)
+}
+
+// printInterfaces prints the method counts and sizes of the interface types
+// that match the command line, as in error iface methods=1 size=16.
+// Empty interfaces are shown as eface, the runtime's name for them.
+// If pkg is not empty, it qualifies each printed name.
+func printInterfaces(pkg string, ifaces []*layout.Interface) {
+	if len(flagExpr) > 0 && len(want) == 0 {
+		return
+	}
+	for _, it := range ifaces {
+		if !matchName(it.Name) || excluded(it.Name) {
+			continue
+		}
+		kind := "iface"
+		if it.Methods == 0 {
+			kind = "eface"
+		}
+		if *flagJSON {
+			type jsonIface struct {
+				Package string `json:"package,omitempty"`
+				Name    string `json:"name"`
+				Kind    string `json:"kind"`
+				Methods int    `json:"methods"`
+				Size    int64  `json:"size"`
+			}
+			jsonIfaces = append(jsonIfaces, jsonIface{pkg, it.Name, kind, it.Methods, it.Size})
+			continue
+		}
+		fmt.Fprintf(stdout, "%s %s methods=%d size=%s\n", qualify(pkg, it.Name), kind, it.Methods, fmtInt(it.Size))
+	}
+}
+
+// needTypes reports whether the command line asks for information
+// that requires type-checking the package.
+func needTypes() bool {
+	if *flagConst || *flagAll {
+		// For the constants missing from go_asm.h.
+		return true
+	}
+	if useColor && (*flagPad || *flagField) {
+		return true
+	}
+	if strings.Contains(*flagTemplate, ".Align") || strings.Contains(*flagTemplate, ".Fields") {
+		// For the alignments and the field sizes and types.
+		return true
+	}
+	return *flagAlign || *flagNextFree || flagCacheline > 0 && *flagField || *flagDeep || *flagEmbed || *flagFlat || *flagExplain || *flagKind || *flagInterfaces || *flagMap || *flagPad || *flagPtr || *flagScan || *flagBiggestField || *flagIface != "" || *flagMethods || *flagArrays && *flagField || *flagCheckAlign || *flagNoTailPad || *flagTotalPad || *flagCost || *flagRecursive || *flagDot || *flagReorder || *flagType || (*flagJSON || *flagCSV) && *flagField
+}
+
+// outTemplate is the parsed -template, or nil.
+var outTemplate *template.Template
+
+// A templateType is the data for -template.
+type templateType struct {
+	Package string // import path, when several packages are named
+	Name    string // qualified by Package
+	Size    int64
+	Align   int64
+	Words   int64
+	Fields  []layout.Field
+}
+
+// A jsonType is the JSON form of a type printed by sizeof.
+type jsonType struct {
+	Package  string         `json:"package,omitempty"`
+	Name     string         `json:"name"`
+	Size     int64          `json:"size"`
+	Words    int64          `json:"words,omitempty"`
+	Kind     string         `json:"kind,omitempty"`
+	Relative *float64       `json:"relative,omitempty"`
+	Symbol   string         `json:"symbol,omitempty"`
+	Fields   []layout.Field `json:"fields,omitempty"`
+	Align    int64          `json:"align,omitempty"`
+	NextFree *int64         `json:"nextfree,omitempty"`
+	Pad      int64          `json:"pad,omitempty"`
+	Ptrs     *jsonPtrs      `json:"ptrs,omitempty"`
+	Scan     *int64         `json:"scan,omitempty"`
+	Biggest  *jsonBiggest   `json:"biggestField,omitempty"`
+	Iface    *ifaceCost     `json:"iface,omitempty"`
+	Deep     *jsonDeep      `json:"deep,omitempty"`
+
+	Cachelines int64           `json:"cachelines,omitempty"`
+	Shared     []sharedLine    `json:"shared,omitempty"`
+	Reorder    *jsonType       `json:"reorder,omitempty"`
+	Reachable  []reachRef      `json:"reachable,omitempty"`
+	Costs      []fieldCost     `json:"costs,omitempty"`
+	Methods    []layout.Method `json:"methods,omitempty"`
+	TailPad    *int64          `json:"tailPad,omitempty"`
+}
+
+// A jsonBiggest is the largest field of a struct type, for -biggest-field.
+type jsonBiggest struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// biggestField returns the largest field of t, the first if several
+// have the same size. It reports false if t has no fields
+// or their sizes are unknown.
+func biggestField(t *layout.Type) (layout.Field, bool) {
+	if !t.FieldSizes() || len(t.Fields) == 0 {
+		return layout.Field{}, false
+	}
+	big := t.Fields[0]
+	for _, f := range t.Fields[1:] {
+		if f.Size > big.Size {
+			big = f
+		}
+	}
+	return big, true
+}
+
+// A fieldCost is the number of bytes a field adds to its struct, for -cost.
+type fieldCost struct {
+	Name string `json:"name"`
+	Cost int64  `json:"cost"` // Size + Pad
+	Pad  int64  `json:"pad"`  // padding before the field
+}
+
+// fieldCosts returns the cost of each field of t, including blank fields,
+// and the size of the tail padding. The costs and the tail padding add up
+// to t's size. It reports false if t's field sizes are unknown.
+func fieldCosts(t *layout.Type) (costs []fieldCost, tail int64, ok bool) {
+	if !t.FieldSizes() {
+		return nil, 0, false
+	}
+	end := int64(0)
+	for _, f := range t.AllFields() {
+		pad := int64(0)
+		if f.Offset > end {
+			pad = f.Offset - end
+		}
+		costs = append(costs, fieldCost{f.Name, pad + f.Size, pad})
+		if e := f.Offset + f.Size; e > end {
+			end = e
+		}
+	}
+	return costs, t.Size - end, true
+}
+
+// A reachRef is a type reachable from another, as printed by -recursive.
+type reachRef struct {
+	Name  string `json:"name"`
+	Size  int64  `json:"size"`
+	Depth int    `json:"depth"` // 1 for the types used by the fields
+}
+
+// reachable returns the named types reachable from t through its fields,
+// in depth-first order, each listed only the first time it is reached.
+// It returns nil if t's field types are unknown.
+func reachable(t *layout.Type) []reachRef {
+	root := t.Graph()
+	if root == nil {
+		return nil
+	}
+	var list []reachRef
+	seen := map[*layout.Node]bool{root: true}
+	var walk func(n *layout.Node, depth int)
+	walk = func(n *layout.Node, depth int) {
+		for _, ref := range n.Refs {
+			if seen[ref.To] {
+				continue
+			}
+			seen[ref.To] = true
+			list = append(list, reachRef{ref.To.Name, ref.To.Size, depth})
+			walk(ref.To, depth+1)
+		}
+	}
+	walk(root, 1)
+	return list
+}
+
+// sortTypes sorts the types according to the -sort flag.
+func sortTypes(list []*layout.Type) {
+	if *flagSort == "" {
+		return
+	}
+	for _, t := range list {
+		sort.SliceStable(t.Fields, func(i, j int) bool {
+			return t.Fields[i].Offset < t.Fields[j].Offset
+		})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return lessType(list[i], list[j])
+	})
+}
+
+// lessType reports whether type a sorts before type b in the -sort order.
+// For -sort=offset, which keeps the compiler's order, it is always false.
+func lessType(a, b *layout.Type) bool {
+	switch *flagSort {
+	case "size":
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+	case "fields":
+		if len(a.Fields) != len(b.Fields) {
+			return len(a.Fields) > len(b.Fields)
+		}
+	case "name":
+		// by name
+	default:
+		return false
+	}
+	return a.Name < b.Name
+}
+
+// sortConsts sorts the constants by name unless -sort=offset asks for
+// the compiler's order and neither -prefix nor -prefix-match was given.
+func sortConsts(consts []*layout.Const) {
+	if !sortConstsByName() {
+		return
+	}
+	sort.SliceStable(consts, func(i, j int) bool {
+		return consts[i].Name < consts[j].Name
+	})
+}
+
+// sortConstsByName reports whether sortConsts sorts the constants by name.
+func sortConstsByName() bool {
+	return (*flagSort != "" && *flagSort != "offset") || *flagPrefix != "" || *flagPrefixMatch
+}
+
+// fields returns the fields of t to print with -f,
+// including the promoted fields if -embed was given
+// or only the leaf fields if -flat was given.
+func fields(t *layout.Type) []layout.Field {
+	if *flagEmbed {
+		return t.EmbeddedFields()
+	}
+	if *flagFlat {
+		return t.FlatFields()
+	}
+	return t.Fields
+}
+
+// explain returns the terms of the size accounting printed by -explain:
+// each field of the struct type t, as in 8 (prog), preceded by any padding
+// inserted to align it, as in 4 pad, and followed by any tail padding,
+// as in 4 tail pad. It returns nil if t is not a struct type
+// or its field sizes are unknown.
+func explain(t *layout.Type) []string {
+	tail, ok := t.TailPad()
+	if !ok {
+		return nil
+	}
+	terms := []string{}
+	end := int64(0)
+	for _, f := range t.AllFields() {
+		if f.Offset > end {
+			terms = append(terms, fmtInt(f.Offset-end)+" pad")
+		}
+		terms = append(terms, fmtInt(f.Size)+" ("+f.Name+")")
+		if e := f.Offset + f.Size; e > end {
+			end = e
+		}
+	}
+	if tail > 0 {
+		terms = append(terms, fmtInt(tail)+" tail pad")
+	}
+	if len(terms) == 0 {
+		terms = append(terms, fmtInt(0))
+	}
+	return terms
+}
+
+// baseline is the -relative-to type in the package being printed.
+var baseline *layout.Type
+
+// relativeSize returns the size of t as a multiple of the size of baseline.
+func relativeSize(t *layout.Type) float64 {
+	return float64(t.Size) / float64(baseline.Size)
+}
+
+// fmtRatio formats the ratio r rounded to two decimal places,
+// as in 3.2 or 0.33.
+func fmtRatio(r float64) string {
+	return strconv.FormatFloat(math.Round(r*100)/100, 'f', -1, 64)
+}
+
+// fieldCount formats n as a number of fields, for -sort fields.
+func fieldCount(n int) string {
+	if n == 1 {
+		return "1 field"
+	}
+	return strconv.Itoa(n) + " fields"
+}
+
+// A jsonDeep is the JSON form of the estimate printed by -deep.
+type jsonDeep struct {
+	Inline   int64 `json:"inline"`
+	Indirect int64 `json:"indirect"`
+	Total    int64 `json:"total"`
+}
+
+// A jsonPtrs is the JSON form of the pointer words printed by -ptr.
+type jsonPtrs struct {
+	Ptrs  int64 `json:"ptrs"`
+	Words int64 `json:"words"`
+}
+
+// countPtrs returns the number of pointer words in t and its total number
+// of words. It reports false if t's field sizes are unknown.
+func countPtrs(t *layout.Type) (ptrs, words int64, ok bool) {
+	mask := t.PtrMask()
+	if mask == nil {
+		return 0, 0, false
+	}
+	for _, p := range mask {
+		if p {
+			ptrs++
+		}
+	}
+	return ptrs, int64(len(mask)), true
+}
+
+// printTypes prints the sizes of the types in list,
+// along with their fields if -f was given.
+// If pkg is not empty, it qualifies each printed name.
+// The word size, used by -map, is ptrSize bytes.
+func printTypes(pkg string, list []*layout.Type, ptrSize int64) {
+	if *flagMax > 0 {
+		for _, t := range list {
+			if t.Size > *flagMax {
+				log.Printf("%s is %d bytes, larger than -max %d", qualify(pkg, t.Name), t.Size, *flagMax)
+				tooBig = true
+			}
+		}
+	}
+	if *flagCheckAlign {
+		for _, t := range list {
+			checkAlign(qualify(pkg, t.Name), t)
+		}
+	}
+	if *flagTotalPad {
+		for _, t := range list {
+			padTotals.add(qualify(pkg, t.Name), t)
+		}
+	}
+	if *flagNoTailPad {
+		for _, t := range list {
+			if tail, ok := t.TailPad(); ok && tail > 0 {
+				log.Printf("%s has %d bytes of tail padding at offset %d", qualify(pkg, t.Name), tail, t.Size-tail)
+				tailPadded = true
+			}
+		}
+	}
+	if *flagDot {
+		for _, t := range list {
+			dotOut.addType(t)
+		}
+		return
+	}
+	if outTemplate != nil {
+		for _, t := range list {
+			data := &templateType{
+				Package: pkg,
+				Name:    qualify(pkg, t.Name),
+				Size:    t.Size,
+				Align:   t.Align,
+				Words:   (t.Size + ptrSize - 1) / ptrSize,
+				Fields:  fields(t),
+			}
+			if err := outTemplate.Execute(stdout, data); err != nil {
+				fatalf("executing -template: %v", err)
+			}
+			fmt.Fprintf(stdout, "\n")
+		}
+		return
+	}
+	if *flagCSV {
+		for _, t := range list {
+			name := qualify(pkg, t.Name)
+			if !*flagField {
+				writeCSV(name, fmt.Sprint(t.Size))
+				continue
+			}
+			if !*flagFieldsOnly {
+				writeCSV(name, "", "", fmt.Sprint(t.Size))
+			}
+			if *flagSizesOnly {
+				continue
+			}
+			for _, f := range fields(t) {
+				size := ""
+				if f.Type != "" {
+					size = fmt.Sprint(f.Size)
+				}
+				writeCSV(name, f.Name, fmt.Sprint(f.Offset), size)
+			}
+		}
+		return
+	}
+	if *flagJSON {
+		for _, t := range list {
+			jt := &jsonType{Package: pkg, Name: t.Name, Size: t.Size}
+			if *flagWords {
+				jt.Words = (t.Size + ptrSize - 1) / ptrSize
+			}
+			if *flagKind {
+				jt.Kind = t.Kind()
+			}
+			if baseline != nil {
+				r := relativeSize(t)
+				jt.Relative = &r
+			}
+			if *flagSymbols {
+				jt.Symbol = t.Symbol
+			}
+			if *flagAlign || *flagNextFree {
+				jt.Align = t.Align
+			}
+			if *flagNextFree && t.Align != 0 {
+				n := nextFree(t)
+				jt.NextFree = &n
+			}
+			if *flagField {
+				jt.Fields = fields(t)
+				if !*flagType {
+					jt.Fields = nil
+					for _, f := range fields(t) {
+						f.Type = ""
+						jt.Fields = append(jt.Fields, f)
+					}
+				}
+			}
+			if *flagField && flagCacheline > 0 {
+				line := int64(flagCacheline)
+				jt.Cachelines = cachelines(t.Size, line)
+				jt.Shared = sharedLines(t, line)
+				for i := range jt.Shared {
+					jt.Shared[i].Line *= line
+				}
+			}
+			if *flagDeep {
+				if indirect, ok := t.DeepSize(*flagDeepLen); ok {
+					jt.Deep = &jsonDeep{t.Size, indirect, t.Size + indirect}
+				}
+			}
+			if *flagPtr {
+				if ptrs, words, ok := countPtrs(t); ok {
+					jt.Ptrs = &jsonPtrs{ptrs, words}
+				}
+			}
+			if *flagScan {
+				if scan, ok := t.ScanSize(); ok {
+					jt.Scan = &scan
+				}
+			}
+			if *flagBiggestField {
+				if f, ok := biggestField(t); ok {
+					jt.Biggest = &jsonBiggest{f.Name, f.Size}
+				}
+			}
+			if ifaceType != nil {
+				if c, ok := ifaceCostOf(t, ptrSize); ok {
+					jt.Iface = &c
+				}
+			}
+			if *flagPad {
+				for _, p := range t.Padding() {
+					jt.Pad += p.Size
+				}
+			}
+			if *flagReorder {
+				if fields, size := t.Reorder(); fields != nil {
+					jt.Reorder = &jsonType{Name: t.Name, Size: size, Fields: fields}
+				}
+			}
+			if *flagRecursive {
+				jt.Reachable = reachable(t)
+			}
+			if *flagMethods {
+				jt.Methods = t.Methods()
+			}
+			if *flagCost {
+				if costs, tail, ok := fieldCosts(t); ok {
+					jt.Costs = costs
+					jt.TailPad = &tail
+				}
+			}
+			jsonOut = append(jsonOut, jt)
+		}
+		return
+	}
+	for _, t := range list {
+		name := qualify(pkg, t.Name)
+		summary.add(name, t.Size)
+		sizeLine := name + " " + fmtInt(t.Size)
+		if *flagKind {
+			if kind := t.Kind(); kind != "" {
+				sizeLine += " " + kind
+			}
+		}
+		if *flagWords {
+			sizeLine += " (" + words(t.Size, ptrSize) + ")"
+		}
+		if *flagSort == "fields" {
+			sizeLine += " (" + fieldCount(len(t.Fields)) + ")"
+		}
+		if baseline != nil {
+			sizeLine += " (" + fmtRatio(relativeSize(t)) + "x " + baseline.Name + ")"
+		}
+		if *flagSymbols && t.Symbol != "" {
+			sizeLine += " [" + t.Symbol + "]"
+		}
+		if useColor && (*flagPad || *flagField) && t.FieldSizes() {
+			total := int64(0)
+			for _, p := range t.Padding() {
+				total += p.Size
+			}
+			sizeLine = colorPad(sizeLine, t.Size, total)
+		}
+		if !*flagFieldsOnly {
+			fmt.Fprintf(stdout, "%s%s\n", linePrefix("type"), sizeLine)
+		}
+		if *flagAlign && t.Align != 0 {
+			fmt.Fprintf(stdout, "%s align %s\n", name, fmtInt(t.Align))
+		}
+		if *flagNextFree && t.Align != 0 {
+			fmt.Fprintf(stdout, "%s size=%s align=%s nextfree=%s\n", name, fmtInt(t.Size), fmtInt(t.Align), fmtInt(nextFree(t)))
+		}
+		if *flagDeep {
+			if indirect, ok := t.DeepSize(*flagDeepLen); ok {
+				fmt.Fprintf(stdout, "%s deep inline=%s indirect=%s total=%s\n", name, fmtInt(t.Size), fmtInt(indirect), fmtInt(t.Size+indirect))
+			} else if *flagVerbose {
+				log.Printf("cannot determine field sizes for %s", t.Name)
+			}
+		}
+		if *flagPtr {
+			if ptrs, words, ok := countPtrs(t); ok {
+				fmt.Fprintf(stdout, "%s ptrs %s/%s\n", name, fmtInt(ptrs), fmtInt(words))
+			} else if *flagVerbose {
+				log.Printf("cannot determine field sizes for %s", t.Name)
+			}
+		}
+		if *flagScan {
+			if scan, ok := t.ScanSize(); !ok {
+				if *flagVerbose {
+					log.Printf("cannot determine field sizes for %s", t.Name)
+				}
+			} else if scan == 0 {
+				fmt.Fprintf(stdout, "%s scan 0 noscan\n", name)
+			} else {
+				fmt.Fprintf(stdout, "%s scan %s/%s\n", name, fmtInt(scan), fmtInt(t.Size))
+			}
+		}
+		if *flagBiggestField {
+			if f, ok := biggestField(t); ok {
+				fmt.Fprintf(stdout, "%s biggest=%s(%s)\n", name, f.Name, fmtInt(f.Size))
+			}
+		}
+		if ifaceType != nil {
+			if c, ok := ifaceCostOf(t, ptrSize); ok {
+				fmt.Fprintf(stdout, "%s\n", c.format(name))
+			}
+		}
+		if *flagExplain {
+			if terms := explain(t); terms != nil {
+				fmt.Fprintf(stdout, "%s explain %s bytes = %s\n", name, fmtInt(t.Size), strings.Join(terms, " + "))
+			} else if !t.FieldSizes() && *flagVerbose {
+				log.Printf("cannot determine field sizes for %s", t.Name)
+			}
+		}
+		var pad []layout.Pad
+		if *flagPad {
+			pad = t.Padding()
+			if pad == nil && !t.FieldSizes() && *flagVerbose {
+				log.Printf("cannot determine field sizes for %s", t.Name)
+			}
+		}
+		total := int64(0)
+		printPad := func(off int64) {
+			for len(pad) > 0 && pad[0].Offset < off {
+				fmt.Fprintf(stdout, "%s.<pad> %s %s\n", name, fmtInt(pad[0].Offset), fmtInt(pad[0].Size))
+				total += pad[0].Size
+				pad = pad[1:]
+			}
+		}
+		// Mark the last cache line boundary before each field.
+		// Boundaries inside a large field are not shown.
+		line := int64(flagCacheline)
+		boundary := int64(0)
+		printBoundary := func(off int64) {
+			if line > 0 && off/line*line > boundary {
+				boundary = off / line * line
+				fmt.Fprintf(stdout, "%s.<cacheline> %s\n", name, fmtInt(boundary))
+			}
+		}
+		if *flagField && !*flagSizesOnly {
+			for _, f := range fields(t) {
+				printPad(f.Offset)
+				printBoundary(f.Offset)
+				suffix := ""
+				if *flagArrays {
+					if dims, elem, ok := t.Array(f.Name); ok {
+						var lens []string
+						for _, d := range dims {
+							lens = append(lens, fmtInt(d))
+						}
+						suffix = fmt.Sprintf(" elem=%s len=%s", fmtInt(elem), strings.Join(lens, "x"))
+					}
+				}
+				line := fmt.Sprintf("%s.%s %s", name, f.Name, fmtInt(f.Offset))
+				if (*flagType || suffix != "") && f.Type != "" {
+					line += " " + f.Type + suffix
+				}
+				if *flagSymbols && f.Symbol != "" {
+					line += " [" + f.Symbol + "]"
+				}
+				fmt.Fprintf(stdout, "%s%s\n", linePrefix("field"), line)
+			}
+		}
+		if *flagPad && t.FieldSizes() {
+			printPad(t.Size)
+			fmt.Fprintf(stdout, "%s <pad> %s\n", name, fmtInt(total))
+		}
+		if *flagField && line > 0 {
+			fmt.Fprintf(stdout, "%s <cachelines> %s\n", name, fmtInt(cachelines(t.Size, line)))
+			for _, l := range sharedLines(t, line) {
+				fmt.Fprintf(stdout, "%s <shared %s> %s\n", name, fmtInt(l.Line*line), strings.Join(l.Fields, " "))
+			}
+		}
+		if *flagReorder {
+			if fields, size := t.Reorder(); fields != nil {
+				fmt.Fprintf(stdout, "%s <%s -> %s>\n", name, fmtInt(t.Size), fmtInt(size))
+				if size < t.Size {
+					for _, f := range fields {
+						fmt.Fprintf(stdout, "%s.%s %s\n", name, f.Name, fmtInt(f.Offset))
+					}
+				}
+			}
+		}
+		if *flagCost {
+			if costs, tail, ok := fieldCosts(t); ok {
+				for _, c := range costs {
+					fmt.Fprintf(stdout, "%s.%s costs %s (+%s pad)\n", name, c.Name, fmtInt(c.Cost), fmtInt(c.Pad))
+				}
+				fmt.Fprintf(stdout, "%s <tail pad> %s\n", name, fmtInt(tail))
+			} else if *flagVerbose {
+				log.Printf("cannot determine field sizes for %s", t.Name)
+			}
+		}
+		if *flagMethods {
+			for _, m := range t.Methods() {
+				if m.Pointer {
+					fmt.Fprintf(stdout, "%s.%s (pointer)\n", name, m.Name)
+				} else {
+					fmt.Fprintf(stdout, "%s.%s (value copy %s bytes)\n", name, m.Name, fmtInt(t.Size))
+				}
+			}
+		}
+		if *flagRecursive {
+			for _, ref := range reachable(t) {
+				fmt.Fprintf(stdout, "%s%s %s\n", strings.Repeat("\t", ref.Depth), ref.Name, fmtInt(ref.Size))
+			}
+		}
+		if *flagMap {
+			printMap(name, t, ptrSize)
+		}
+	}
+}
+
+// A topType is a type held back by -top until all packages are loaded.
+type topType struct {
+	pkg     string
+	t       *layout.Type
+	ptrSize int64
+
+	// The -relative-to baseline, the -iface interface, and the package
+	// holding t, which are reset for each package loaded.
+	baseline *layout.Type
+	iface    *types.Interface
+	ifacePkg *types.Package
+}
+
+// topTypes accumulates the types considered by -top.
+var topTypes []topType
+
+// printTop prints the -top largest types in topTypes, largest first.
+// Types of equal size are printed in order of their qualified names.
+func printTop() {
+	sort.SliceStable(topTypes, func(i, j int) bool {
+		ti, tj := topTypes[i], topTypes[j]
+		if ti.t.Size != tj.t.Size {
+			return ti.t.Size > tj.t.Size
+		}
+		return qualify(ti.pkg, ti.t.Name) < qualify(tj.pkg, tj.t.Name)
+	})
+	if len(topTypes) > *flagTop {
+		topTypes = topTypes[:*flagTop]
+	}
+	for _, tt := range topTypes {
+		baseline, ifaceType, ifacePkg = tt.baseline, tt.iface, tt.ifacePkg
+		printTypes(tt.pkg, []*layout.Type{tt.t}, tt.ptrSize)
+	}
+}
+
+// nextFree returns the offset at which a field following a field of type t
+// would be placed when t is embedded in a struct: t's size rounded up
+// to its alignment. For the layouts computed by the Go compiler,
+// which always round sizes to the alignment, it is the size itself.
+func nextFree(t *layout.Type) int64 {
+	return (t.Size + t.Align - 1) / t.Align * t.Align
+}
+
+// words returns the size in machine words of a type of the given size,
+// rounded up, as in "3 words".
+func words(size, ptrSize int64) string {
+	n := (size + ptrSize - 1) / ptrSize
+	if n == 1 {
+		return "1 word"
+	}
+	return fmtInt(n) + " words"
+}
+
+// tooBig records whether any type exceeded the -max limit.
+var tooBig bool
+
+// misaligned records whether -check-align found a misaligned field.
+var misaligned bool
+
+// tailPadded records whether -no-tail-pad found a struct with tail padding.
+var tailPadded bool
+
+// checkAlign reports the fields of t, printed as name,
+// whose offsets are not multiples of their natural alignment.
+func checkAlign(name string, t *layout.Type) {
+	if t.Obj == nil {
+		if *flagVerbose {
+			log.Printf("cannot determine field sizes for %s", t.Name)
+		}
+		return
+	}
+	for _, m := range t.Misaligned() {
+		log.Printf("%s.%s at offset %d is misaligned by %d for its alignment %d", name, m.Field.Name, m.Field.Offset, m.By, m.Align)
+		misaligned = true
+	}
+}
+
+// summary accumulates the statistics printed by -sum.
+var summary sizeSummary
+
+// A sizeSummary holds statistics about a set of types.
+type sizeSummary struct {
+	count   int
+	total   int64
+	largest string
+	max     int64
+}
+
+// add adds the type name with the given size to the summary.
+func (s *sizeSummary) add(name string, size int64) {
+	s.count++
+	s.total += size
+	if s.count == 1 || size > s.max {
+		s.largest = name
+		s.max = size
+	}
+}
+
+// print prints the summary. Each line begins with #,
+// so that scripts can easily skip the summary.
+func (s *sizeSummary) print() {
+	fmt.Fprintf(stdout, "# types: %d\n", s.count)
+	fmt.Fprintf(stdout, "# total: %s\n", fmtInt(s.total))
+	if s.count > 0 {
+		fmt.Fprintf(stdout, "# largest: %s %s\n", s.largest, fmtInt(s.max))
+		fmt.Fprintf(stdout, "# average: %.1f\n", float64(s.total)/float64(s.count))
+	}
+}
+
+// matchCount is the number of types or constants counted by -count.
+var matchCount int
+
+// padTotals accumulates the padding printed by -total-pad.
+var padTotals padSummary
+
+// A padSummary accumulates the padding in the struct types printed,
+// internal and tail padding alike.
+type padSummary struct {
+	count int // struct types printed
+	total int64
+	types []padType // types with padding
+}
+
+// A padType is a struct type with padding, for -total-pad.
+type padType struct {
+	name string
+	pad  int64
+}
+
+// add adds the struct type t, printed as name, to the summary.
+// Types that are not structs or whose field sizes are unknown are skipped.
+func (s *padSummary) add(name string, t *layout.Type) {
+	if _, ok := t.TailPad(); !ok {
+		return
+	}
+	s.count++
+	pad := int64(0)
+	for _, p := range t.Padding() {
+		pad += p.Size
+	}
+	if pad > 0 {
+		s.total += pad
+		s.types = append(s.types, padType{name, pad})
+	}
+}
+
+// print prints the total padding and then the types with padding,
+// most padding first, ties broken by name. Like the -sum summary,
+// each line begins with #.
+func (s *padSummary) print() {
+	sort.SliceStable(s.types, func(i, j int) bool {
+		if s.types[i].pad != s.types[j].pad {
+			return s.types[i].pad > s.types[j].pad
+		}
+		return s.types[i].name < s.types[j].name
+	})
+	fmt.Fprintf(stdout, "# total padding: %s bytes in %d of %d struct types\n", fmtInt(s.total), len(s.types), s.count)
+	for _, pt := range s.types {
+		fmt.Fprintf(stdout, "# %s %s\n", pt.name, fmtInt(pt.pad))
+	}
+}
+
+// printConsts prints the values of the constants.
+// If pkg is not empty, it qualifies each printed name.
+func printConsts(pkg string, consts []*layout.Const) {
+	if *flagCSV {
+		for _, c := range consts {
+			writeCSV(qualify(pkg, c.Name), csvValue(c.Value))
+		}
+		return
+	}
+	if *flagJSON {
+		type jsonConst struct {
+			Package string          `json:"package,omitempty"`
+			Name    string          `json:"name"`
+			Value   json.RawMessage `json:"value"`
+		}
+		for _, c := range consts {
+			jsonConsts = append(jsonConsts, jsonConst{pkg, c.Name, jsonValue(c.Value)})
+		}
+		return
+	}
+	for _, c := range consts {
+		fmt.Fprintf(stdout, "%s%s %s\n", linePrefix("const"), qualify(pkg, c.Name), fmtValue(c.Value))
+	}
+}
+
+// linePrefix returns the prefix for a text line of the given kind,
+// type, field, or const: kind followed by a colon if -prefix-lines
+// was given, and otherwise "".
+func linePrefix(kind string) string {
+	if !*flagPrefixLines {
+		return ""
+	}
+	return kind + ":"
+}
+
+// fmtInt formats n for text output, in hexadecimal if -hex was given,
+// or in decimal followed by hexadecimal, as in 16 0x10, if -dechex was given.
+func fmtInt(n int64) string {
+	if *flagDecHex {
+		return fmt.Sprintf("%d %#x", n, n)
+	}
+	if *flagHex {
+		return fmtValue(strconv.FormatInt(n, 10))
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// fmtDelta formats the difference n in the same base as fmtInt,
+// with an explicit sign, as in +8, +0x8, or +8 +0x8.
+func fmtDelta(n int64) string {
+	if *flagDecHex {
+		return fmt.Sprintf("%+d %+#x", n, n)
+	}
+	if *flagHex {
+		return fmt.Sprintf("%+#x", n)
+	}
+	return fmt.Sprintf("%+d", n)
+}
+
+// fmtValue formats the constant value val from go_asm.h for text output.
+// If -hex was given, integers are printed in hexadecimal, with a leading
+// minus sign for negative values. Other values are printed unchanged.
+func fmtValue(val string) string {
+	if !*flagHex {
+		return val
+	}
+	n, ok := new(big.Int).SetString(val, 10)
+	if !ok {
+		return val
+	}
+	if n.Sign() < 0 {
+		return "-0x" + new(big.Int).Neg(n).Text(16)
+	}
+	return "0x" + n.Text(16)
+}
+
+// jsonValue returns the JSON encoding of a constant value from go_asm.h.
+// Numbers and booleans are already valid JSON; strings are Go-quoted
+// and must be converted.
+func jsonValue(val string) json.RawMessage {
+	if strings.HasPrefix(val, `"`) {
+		if s, err := strconv.Unquote(val); err == nil {
+			val = s
+		}
+	} else if json.Valid([]byte(val)) {
+		return json.RawMessage(val)
+	}
+	js, _ := json.Marshal(val)
+	return js
+}
+
+// jsonSchema is the version of the JSON document printed by -json.
+// It must be incremented whenever the structure of the document changes
+// incompatibly, such as when a key is renamed or removed or the type of its
+// value changes. Adding keys does not require a new version.
+//
+// Version 2 made "goarch" an array of strings with -arch.
+const jsonSchema = 2
+
+// jsonOut, jsonConsts, and jsonIfaces accumulate the types, constants,
+// and interfaces printed in the JSON document.
+var (
+	jsonOut    []interface{}
+	jsonConsts []interface{}
+	jsonIfaces []interface{}
+)
+
+// jsonGOOS and jsonGOARCH record the target system of the first package loaded.
+var jsonGOOS, jsonGOARCH string
+
+// jsonDocument returns the JSON document holding the accumulated results.
+func jsonDocument() interface{} {
+	type jsonDoc struct {
+		Schema     int           `json:"schema"`
+		GOOS       string        `json:"goos,omitempty"`
+		GOARCH     interface{}   `json:"goarch,omitempty"` // string, or []string for -arch
+		Types      []interface{} `json:"types"`
+		Consts     []interface{} `json:"consts,omitempty"`
+		Interfaces []interface{} `json:"interfaces,omitempty"`
+	}
+	doc := jsonDoc{jsonSchema, jsonGOOS, nil, jsonOut, jsonConsts, jsonIfaces}
+	if *flagArch != "" {
+		doc.GOARCH = strings.Split(*flagArch, ",")
+	} else if jsonGOARCH != "" {
+		doc.GOARCH = jsonGOARCH
+	}
+	if doc.Types == nil {
+		doc.Types = []interface{}{}
+	}
+	if *flagConst && doc.Consts == nil {
+		doc.Consts = []interface{}{}
+	}
+	return doc
+}
+
+// printJSON prints v as an indented JSON document.
+func printJSON(v interface{}) {
+	js, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Fprintf(stdout, "%s\n", js)
+}
+
+// printJSONLines prints the types, constants, and interfaces
+// collected for the JSON document as JSON Lines, for -jsonl:
+// one compact JSON object per line.
+func printJSONLines() {
+	for _, list := range [][]interface{}{jsonOut, jsonConsts, jsonIfaces} {
+		for _, v := range list {
+			js, err := json.Marshal(v)
+			if err != nil {
+				fatal(err)
+			}
+			fmt.Fprintf(stdout, "%s\n", js)
+		}
+	}
+}
+
+// printArchTable prints the types or constants from each package in ps
+// in a table with one column per architecture.
+// If pkg is not empty, it qualifies each printed name.
+func printArchTable(pkg string, archs []string, ps []*layout.Package) {
+	type row struct {
+		name string
+		vals map[string]string
+	}
+	// divergent reports whether r's value differs between architectures,
+	// including whether r is missing for some of them.
+	divergent := func(r *row) bool {
+		first, present := "", 0
+		for _, arch := range archs {
+			val, ok := r.vals[arch]
+			if !ok {
+				continue
+			}
+			if present++; present == 1 {
+				first = val
+			} else if val != first {
+				return true
+			}
+		}
+		return present != len(archs)
+	}
+	// Each type's row is followed by its field rows.
+	// The types are sorted using the first layout seen for each,
+	// so that -sort=size uses the first architecture's sizes,
+	// and the fields are kept in offset order.
+	type group struct {
+		t      *layout.Type // nil for a constant
+		rows   []*row
+		offset map[*row]int64
+	}
+	var groups []*group
+	byType := make(map[string]*group)
+	byName := make(map[string]*row)
+	add := func(g *group, name, arch, val string) *row {
+		r := byName[name]
+		if r == nil {
+			r = &row{name: name, vals: make(map[string]string)}
+			byName[name] = r
+			g.rows = append(g.rows, r)
+		}
+		r.vals[arch] = val
+		return r
+	}
+	for i, p := range ps {
+		arch := archs[i]
+		if *flagConst {
+			for _, c := range p.Consts {
+				if !matchConst(c) {
+					continue
+				}
+				g := byType[c.Name]
+				if g == nil {
+					g = &group{}
+					byType[c.Name] = g
+					groups = append(groups, g)
+				}
+				add(g, c.Name, arch, c.Value)
+			}
+			continue
+		}
+		for _, t := range p.Types {
+			if !matchType(t) {
+				continue
+			}
+			g := byType[t.Name]
+			if g == nil {
+				g = &group{t: t, offset: make(map[*row]int64)}
+				byType[t.Name] = g
+				groups = append(groups, g)
+			}
+			add(g, t.Name, arch, fmt.Sprint(t.Size))
+			if *flagField {
+				for _, f := range t.Fields {
+					r := add(g, t.Name+"."+f.Name, arch, fmt.Sprint(f.Offset))
+					if _, ok := g.offset[r]; !ok {
+						g.offset[r] = f.Offset
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if a.t == nil {
+			return sortConstsByName() && a.rows[0].name < b.rows[0].name
+		}
+		return lessType(a.t, b.t)
+	})
+	var rows []*row
+	for _, g := range groups {
+		if g.t != nil && *flagSort != "" {
+			fields := g.rows[1:]
+			sort.SliceStable(fields, func(i, j int) bool {
+				return g.offset[fields[i]] < g.offset[fields[j]]
+			})
+		}
+		rows = append(rows, g.rows...)
+	}
+
+	if *flagJSON {
+		type jsonRow struct {
+			Package string                     `json:"package,omitempty"`
+			Name    string                     `json:"name"`
+			Vals    map[string]json.RawMessage `json:"size"`
+			Diverge bool                       `json:"divergent,omitempty"`
+		}
+		for _, r := range rows {
+			jr := jsonRow{Package: pkg, Name: r.name, Vals: make(map[string]json.RawMessage), Diverge: divergent(r)}
+			for arch, val := range r.vals {
+				jr.Vals[arch] = jsonValue(val)
+			}
+			if *flagConst {
+				jsonConsts = append(jsonConsts, jr)
+			} else {
+				jsonOut = append(jsonOut, jr)
+			}
+		}
+		return
+	}
+
+	if *flagCSV {
+		for _, r := range rows {
+			rec := []string{qualify(pkg, r.name)}
+			for _, arch := range archs {
+				rec = append(rec, csvValue(r.vals[arch]))
+			}
+			writeCSV(rec...)
+		}
+		return
+	}
+
+	// Every line ends in a cell for the divergence mark, even if empty,
+	// so that the tabwriter aligns the last column on every line;
+	// the padding this leaves at the ends of lines is trimmed.
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(w, "name\t%s\t\n", strings.Join(archs, "\t"))
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s", qualify(pkg, r.name))
+		for _, arch := range archs {
+			val, ok := r.vals[arch]
+			if !ok {
+				val = "-"
+			} else {
+				val = fmtValue(val)
+			}
+			fmt.Fprintf(w, "\t%s", val)
+		}
+		mark := ""
+		if divergent(r) {
+			mark = "*"
+		}
+		fmt.Fprintf(w, "\t%s\n", mark)
+	}
+	w.Flush()
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line != "" {
+			fmt.Fprintf(stdout, "%s\n", strings.TrimRight(line, " \n"))
+		}
+	}
+}
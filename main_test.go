@@ -0,0 +1,361 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"rsc.io/sizeof/layout"
+)
+
+var splitArgsTests = []struct {
+	in  string
+	out []string
+	err bool
+}{
+	{"", nil, false},
+	{"-race", []string{"-race"}, false},
+	{"  -race \t -v\n", []string{"-race", "-v"}, false},
+	{"-gcflags='-N -l' -race", []string{"-gcflags=-N -l", "-race"}, false},
+	{`-ldflags "-X main.v=1"`, []string{"-ldflags", "-X main.v=1"}, false},
+	{`''`, []string{""}, false},
+	{`-gcflags='-N`, nil, true},
+}
+
+func TestSplitArgs(t *testing.T) {
+	for _, tt := range splitArgsTests {
+		out, err := splitArgs(tt.in)
+		if (err != nil) != tt.err || !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("splitArgs(%q) = %q, %v, want %q, error %v", tt.in, out, err, tt.out, tt.err)
+		}
+	}
+}
+
+// resetArgs clears the state set by parseArgs and splitQualified.
+func resetArgs() {
+	flagPkg = nil
+	pkgNames = make(map[string][]string)
+	want = nil
+	cmd = nil
+}
+
+var parseArgsTests = []struct {
+	args     []string
+	names    []string
+	pkgs     []string
+	pkgNames map[string][]string
+}{
+	{
+		args:     []string{"T", "U"},
+		names:    []string{"T", "U"},
+		pkgNames: map[string][]string{},
+	},
+	{
+		args:     []string{"-p", "net/http", "Request", "Response", "-p", "net/url", "URL"},
+		pkgs:     []string{"net/http", "net/url"},
+		pkgNames: map[string][]string{"net/http": {"Request", "Response"}, "net/url": {"URL"}},
+	},
+	{
+		args:     []string{"Header", "-p", "net/http,net/textproto", "Request"},
+		names:    []string{"Header"},
+		pkgs:     []string{"net/http", "net/textproto"},
+		pkgNames: map[string][]string{"net/http": {"Request"}, "net/textproto": {"Request"}},
+	},
+	{
+		args:     []string{"types", "-p", "io", "Reader"},
+		pkgs:     []string{"io"},
+		pkgNames: map[string][]string{"io": {"Reader"}},
+	},
+}
+
+func TestParseArgs(t *testing.T) {
+	// Keep a configuration file in the home directory out of the test.
+	t.Setenv("HOME", t.TempDir())
+	defer func(args []string) { os.Args = args }(os.Args)
+	defer resetArgs()
+	for _, tt := range parseArgsTests {
+		resetArgs()
+		os.Args = append([]string{"sizeof"}, tt.args...)
+		names := parseArgs()
+		if !reflect.DeepEqual(names, tt.names) || !reflect.DeepEqual([]string(flagPkg), tt.pkgs) || !reflect.DeepEqual(pkgNames, tt.pkgNames) {
+			t.Errorf("parseArgs(%q) = %q, -p %q, pkgNames %q, want %q, -p %q, pkgNames %q", tt.args, names, flagPkg, pkgNames, tt.names, tt.pkgs, tt.pkgNames)
+		}
+	}
+}
+
+var splitQualifiedTests = []struct {
+	want     []string
+	pkgs     []string
+	pkgNames map[string][]string
+
+	outWant     []string
+	outPkgs     []string
+	outPkgNames map[string][]string
+}{
+	{
+		want:        []string{"T", "U"},
+		outWant:     []string{"T", "U"},
+		outPkgNames: map[string][]string{},
+	},
+	{
+		want:        []string{"net/http.Request"},
+		outPkgs:     []string{"net/http"},
+		outPkgNames: map[string][]string{"net/http": {"Request"}},
+	},
+	{
+		want:        []string{"net/http.Request", "T", "net/url.URL", "net/http.Response"},
+		outPkgs:     []string{"", "net/http", "net/url"},
+		outPkgNames: map[string][]string{"": {"T"}, "net/http": {"Request", "Response"}, "net/url": {"URL"}},
+	},
+	{
+		// With -p, unqualified names are still sought in every package.
+		want:        []string{"T", "regexp.Regexp"},
+		pkgs:        []string{"net/url"},
+		outWant:     []string{"T"},
+		outPkgs:     []string{"net/url", "regexp"},
+		outPkgNames: map[string][]string{"regexp": {"Regexp"}},
+	},
+	{
+		// Qualified names after a -p flag are moved to their own package.
+		pkgs:        []string{"net/url"},
+		pkgNames:    map[string][]string{"net/url": {"URL", "net/http.Request"}},
+		outPkgs:     []string{"net/url", "net/http"},
+		outPkgNames: map[string][]string{"net/url": {"URL"}, "net/http": {"Request"}},
+	},
+	{
+		// Generic instantiations are left alone, to be measured like -expr.
+		want:        []string{"Pair[a.B, c.D]", "List[int]", "io.Reader"},
+		outWant:     []string{"Pair[a.B, c.D]", "List[int]"},
+		outPkgs:     []string{"io"},
+		outPkgNames: map[string][]string{"io": {"Reader"}},
+	},
+	{
+		want:        []string{"a.", ".b", "a.1"},
+		outWant:     []string{"a.", ".b", "a.1"},
+		outPkgNames: map[string][]string{},
+	},
+}
+
+func TestSplitQualified(t *testing.T) {
+	defer resetArgs()
+	for _, tt := range splitQualifiedTests {
+		resetArgs()
+		want = append([]string(nil), tt.want...)
+		flagPkg = append(listFlag(nil), tt.pkgs...)
+		for k, v := range tt.pkgNames {
+			pkgNames[k] = append([]string(nil), v...)
+		}
+		splitQualified()
+		if !reflect.DeepEqual(want, tt.outWant) || !reflect.DeepEqual([]string(flagPkg), tt.outPkgs) || !reflect.DeepEqual(pkgNames, tt.outPkgNames) {
+			t.Errorf("splitQualified(%q, -p %q, %q):\nhave %q, -p %q, %q\nwant %q, -p %q, %q", tt.want, tt.pkgs, tt.pkgNames, want, flagPkg, pkgNames, tt.outWant, tt.outPkgs, tt.outPkgNames)
+		}
+	}
+}
+
+// archPackages returns packages for 386 and amd64 holding the types
+// Emb, declared for both, and Big, declared only for amd64.
+func archPackages() []*layout.Package {
+	emb := func(size int64) *layout.Type {
+		return &layout.Type{Name: "Emb", Size: size, Fields: []layout.Field{
+			{Name: "Mutex", Offset: 0},
+			{Name: "Inner", Offset: 8},
+			{Name: "A", Offset: size - 4},
+		}}
+	}
+	return []*layout.Package{
+		{GOARCH: "386", Types: []*layout.Type{emb(20), {Name: "All", Size: 4}}},
+		{GOARCH: "amd64", Types: []*layout.Type{emb(24), {Name: "All", Size: 4}, {Name: "Big", Size: 32}}},
+	}
+}
+
+var archTableTests = []struct {
+	sort string
+	out  string
+}{
+	{"name", `name      386 amd64
+All       4   4
+Big       -   32    *
+Emb       20  24    *
+Emb.Mutex 0   0
+Emb.Inner 8   8
+Emb.A     16  20    *
+`},
+	{"size", `name      386 amd64
+Big       -   32    *
+Emb       20  24    *
+Emb.Mutex 0   0
+Emb.Inner 8   8
+Emb.A     16  20    *
+All       4   4
+`},
+}
+
+func TestArchTableSort(t *testing.T) {
+	defer func(sort string, field bool) { *flagSort, *flagField = sort, field }(*flagSort, *flagField)
+	defer func(w *bufio.Writer) { stdout = w }(stdout)
+	resetArgs()
+	*flagField = true
+	for _, tt := range archTableTests {
+		*flagSort = tt.sort
+		var buf bytes.Buffer
+		stdout = bufio.NewWriter(&buf)
+		printArchTable("", []string{"386", "amd64"}, archPackages())
+		stdout.Flush()
+		if buf.String() != tt.out {
+			t.Errorf("-sort=%s -arch 386,amd64:\nhave:\n%s\nwant:\n%s", tt.sort, buf.String(), tt.out)
+		}
+	}
+}
+
+var csvHeaderTests = []struct {
+	arch  string
+	c, f  bool
+	names []string
+}{
+	{"", false, false, []string{"name", "size"}},
+	{"", false, true, []string{"type", "field", "offset", "size"}},
+	{"", true, false, []string{"name", "value"}},
+	{"amd64,386", false, true, []string{"name", "amd64", "386"}},
+	{"amd64,386", true, false, []string{"name", "amd64", "386"}},
+}
+
+func TestCSVHeader(t *testing.T) {
+	defer func(arch string, c, f bool) { *flagArch, *flagConst, *flagField = arch, c, f }(*flagArch, *flagConst, *flagField)
+	for _, tt := range csvHeaderTests {
+		*flagArch, *flagConst, *flagField = tt.arch, tt.c, tt.f
+		if names := csvHeader(); !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("csvHeader() with -arch=%q -c=%v -f=%v = %q, want %q", tt.arch, tt.c, tt.f, names, tt.names)
+		}
+	}
+}
+
+var splitColsTests = []struct {
+	line string
+	cols []string
+}{
+	{"T 24", []string{"T", "24"}},
+	{"T.a 8 int", []string{"T.a", "8", "int"}},
+	{"Pair[string, error] 32", []string{"Pair[string, error]", "32"}},
+	{"T.m 0 map[string]int (ptr)", []string{"T.m", "0", "map[string]int (ptr)"}},
+	{colorRed + "T 24 pad=7" + colorReset, []string{colorRed + "T", "24", "pad=7" + colorReset}},
+	{colorGreen + "Pair[a, b] 16" + colorReset, []string{colorGreen + "Pair[a, b]", "16" + colorReset}},
+}
+
+func TestSplitCols(t *testing.T) {
+	for _, tt := range splitColsTests {
+		if cols := splitCols(tt.line); !reflect.DeepEqual(cols, tt.cols) {
+			t.Errorf("splitCols(%q) = %q, want %q", tt.line, cols, tt.cols)
+		}
+	}
+}
+
+func TestAlignerColor(t *testing.T) {
+	var buf bytes.Buffer
+	a := &aligner{w: &buf}
+	a.Write([]byte(colorRed + "Big 100 pad=7" + colorReset + "\n"))
+	a.Write([]byte("Big.a 8 int64\n"))
+	a.Write([]byte(colorGreen + "T 24" + colorReset + "\n"))
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := colorRed + "Big   100 pad=7" + colorReset + "\n" +
+		"Big.a 8   int64\n" +
+		colorGreen + "T     24" + colorReset + "\n"
+	if buf.String() != want {
+		t.Errorf("aligned colored lines:\nhave %q\nwant %q", buf.String(), want)
+	}
+}
+
+func TestArchTableConstExclude(t *testing.T) {
+	defer func(c bool, exclude listFlag) { *flagConst, flagExclude = c, exclude }(*flagConst, flagExclude)
+	defer func(w *bufio.Writer) { stdout = w }(stdout)
+	resetArgs()
+	*flagConst = true
+	flagExclude = listFlag{"X"}
+	consts := []*layout.Const{{Name: "N", Value: "1"}, {Name: "X", Value: "2"}}
+	ps := []*layout.Package{{GOARCH: "386", Consts: consts}, {GOARCH: "amd64", Consts: consts}}
+	var buf bytes.Buffer
+	stdout = bufio.NewWriter(&buf)
+	printArchTable("", []string{"386", "amd64"}, ps)
+	stdout.Flush()
+	if want := "name 386 amd64\nN    1   1\n"; buf.String() != want {
+		t.Errorf("-arch 386,amd64 -c -exclude X:\nhave:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestJSONDocumentArch(t *testing.T) {
+	defer func(arch string) { *flagArch = arch }(*flagArch)
+	*flagArch = "amd64,386"
+	js, err := json.Marshal(jsonDocument())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Schema int      `json:"schema"`
+		GOARCH []string `json:"goarch"`
+	}
+	if err := json.Unmarshal(js, &doc); err != nil {
+		t.Fatalf("-arch amd64,386 -json: %v\n%s", err, js)
+	}
+	if doc.Schema != jsonSchema || !reflect.DeepEqual(doc.GOARCH, []string{"amd64", "386"}) {
+		t.Errorf("-arch amd64,386 -json: schema %d, goarch %q, want %d, [amd64 386]", doc.Schema, doc.GOARCH, jsonSchema)
+	}
+}
+
+var fmtDeltaTests = []struct {
+	n           int64
+	hex, dechex bool
+	out         string
+}{
+	{8, false, false, "+8"},
+	{-16, false, false, "-16"},
+	{24, true, false, "+0x18"},
+	{-24, true, false, "-0x18"},
+	{24, false, true, "+24 +0x18"},
+	{-24, false, true, "-24 -0x18"},
+}
+
+func TestFmtDelta(t *testing.T) {
+	defer func(hex, dechex bool) { *flagHex, *flagDecHex = hex, dechex }(*flagHex, *flagDecHex)
+	for _, tt := range fmtDeltaTests {
+		*flagHex, *flagDecHex = tt.hex, tt.dechex
+		if out := fmtDelta(tt.n); out != tt.out {
+			t.Errorf("fmtDelta(%d) with -hex=%v -dechex=%v = %q, want %q", tt.n, tt.hex, tt.dechex, out, tt.out)
+		}
+	}
+}
+
+var mapCellsTests = []struct {
+	size   int64
+	fields []layout.Field
+	cells  string
+	scale  int64
+}{
+	{12, []layout.Field{{Name: "a", Offset: 0, Size: 1}, {Name: "b", Offset: 4, Size: 8}}, "a...bbbbbbbb", 1},
+	{0, nil, "", 1},
+	{mapMaxCells, []layout.Field{{Name: "a", Offset: 0, Size: mapMaxCells}}, strings.Repeat("a", mapMaxCells), 1},
+	{
+		// Scaled, the small fields still show where they start.
+		1<<30 + 16,
+		[]layout.Field{{Name: "a", Offset: 0, Size: 1}, {Name: "buf", Offset: 1, Size: 1 << 30}, {Name: "tail", Offset: 1<<30 + 8, Size: 8}},
+		"a" + strings.Repeat("b", 2047) + "c",
+		1 << 19,
+	},
+}
+
+func TestMapCells(t *testing.T) {
+	for _, tt := range mapCellsTests {
+		cells, scale := mapCells(tt.size, tt.fields)
+		if string(cells) != tt.cells || scale != tt.scale {
+			t.Errorf("mapCells(%d, %v) = %d cells %.40q..., scale %d, want %d cells %.40q..., scale %d", tt.size, tt.fields, len(cells), cells, scale, len(tt.cells), tt.cells, tt.scale)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"rsc.io/sizeof/layout"
+)
+
+// mapLetters are the letters used to mark fields in a -map layout.
+// Fields beyond the last letter share the final #.
+const mapLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789#"
+
+// mapMaxCells is the number of cells above which a -map layout is scaled,
+// so that drawing a large array type does not take one cell per byte.
+const mapMaxCells = 4096
+
+// printMap prints the -map layout of t, which is printed as name.
+// Each line is split into words of ptrSize bytes.
+// A type larger than mapMaxCells bytes is drawn with each cell standing
+// for a power of two bytes, so that there are at most mapMaxCells cells;
+// a cell shows the first field starting in it or, if none does,
+// the first field occupying any of its bytes.
+func printMap(name string, t *layout.Type, ptrSize int64) {
+	if !t.FieldSizes() {
+		if *flagVerbose {
+			log.Printf("cannot determine field sizes for %s", t.Name)
+		}
+		return
+	}
+	fields := t.AllFields()
+	cells, scale := mapCells(t.Size, fields)
+
+	// Print 8 cells per line, split into words.
+	word := int(ptrSize / scale)
+	if word < 1 {
+		word = 1
+	}
+	const width = 8
+	if scale == 1 {
+		fmt.Fprintf(stdout, "%s map:\n", name)
+	} else {
+		fmt.Fprintf(stdout, "%s map, %s bytes per cell:\n", name, fmtInt(scale))
+	}
+	last := ""
+	elided := false
+	for off := 0; off < len(cells); off += width {
+		end := off + width
+		if end > len(cells) {
+			end = len(cells)
+		}
+		var chunks []string
+		for i := off; i < end; i += word {
+			j := i + word
+			if j > end {
+				j = end
+			}
+			chunks = append(chunks, string(cells[i:j]))
+		}
+		line := "[" + strings.Join(chunks, " ") + "]"
+		if line == last && end < len(cells) {
+			if !elided {
+				fmt.Fprintf(stdout, "\t*\n")
+				elided = true
+			}
+			continue
+		}
+		last = line
+		elided = false
+		fmt.Fprintf(stdout, "\t%s %s\n", fmtInt(int64(off)*scale), line)
+	}
+	for i, f := range fields {
+		fmt.Fprintf(stdout, "\t%c = %s (%s)\n", mapLetter(i), f.Name, fmtInt(f.Size))
+	}
+	fmt.Fprintf(stdout, "\t. = padding\n")
+}
+
+// mapCells returns the cells of the -map layout of a type of the given size
+// holding fields, each the letter of the field occupying it or a dot for
+// padding, along with the number of bytes each cell stands for.
+func mapCells(size int64, fields []layout.Field) ([]byte, int64) {
+	scale := int64(1)
+	for (size+scale-1)/scale > mapMaxCells {
+		scale *= 2
+	}
+	cells := []byte(strings.Repeat(".", int((size+scale-1)/scale)))
+	for i, f := range fields {
+		if f.Size == 0 {
+			continue
+		}
+		end := f.Offset + f.Size
+		if end > size {
+			end = size
+		}
+		for j := f.Offset / scale; j < int64(len(cells)) && j*scale < end; j++ {
+			if cells[j] == '.' {
+				cells[j] = mapLetter(i)
+			}
+		}
+	}
+	if scale > 1 {
+		// Show every field in the cell where it starts.
+		for i := len(fields) - 1; i >= 0; i-- {
+			if f := fields[i]; f.Size > 0 && f.Offset < size {
+				cells[f.Offset/scale] = mapLetter(i)
+			}
+		}
+	}
+	return cells, scale
+}
+
+// mapLetter returns the letter marking the i'th field in a -map layout.
+func mapLetter(i int) byte {
+	if i >= len(mapLetters) {
+		i = len(mapLetters) - 1
+	}
+	return mapLetters[i]
+}
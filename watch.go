@@ -0,0 +1,102 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"rsc.io/sizeof/layout"
+)
+
+const (
+	watchPoll     = 500 * time.Millisecond // how often to check for changes
+	watchDebounce = 300 * time.Millisecond // how long changes must settle
+)
+
+// watch watches the directories of the packages named by paths,
+// rerunning sizeof each time a .go file changes. It never returns.
+func watch(paths []string) {
+	var dirs []string
+	for _, path := range paths {
+		dir, err := layout.Dir(path, options(nil))
+		if err != nil {
+			fatal(err)
+		}
+		dirs = append(dirs, dir)
+	}
+
+	last := snapshot(dirs)
+	for {
+		time.Sleep(watchPoll)
+		cur := snapshot(dirs)
+		if cur == last {
+			continue
+		}
+		// Wait for the changes to settle, so that an editor
+		// writing several files (or one file several times)
+		// triggers only one rebuild.
+		for {
+			time.Sleep(watchDebounce)
+			next := snapshot(dirs)
+			if next == cur {
+				break
+			}
+			cur = next
+		}
+		if *flagVerbose {
+			log.Printf("sources changed; rerunning")
+		}
+		fmt.Fprintf(os.Stdout, "\x1b[H\x1b[2J")
+		resetResults()
+		run(paths)
+		last = snapshot(dirs)
+	}
+}
+
+// snapshot returns a string describing the names, sizes, and modification times
+// of the .go files in dirs, ignoring the temporary files written by sizeof itself.
+func snapshot(dirs []string) string {
+	var buf strings.Builder
+	for _, dir := range dirs {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			fmt.Fprintf(&buf, "%s: %v\n", dir, err)
+			continue
+		}
+		for _, fi := range infos {
+			name := fi.Name()
+			if !strings.HasSuffix(name, ".go") || strings.HasPrefix(name, "xxx_rsc_io_sizeof_") {
+				continue
+			}
+			fmt.Fprintf(&buf, "%s %d %d\n", filepath.Join(dir, name), fi.Size(), fi.ModTime().UnixNano())
+		}
+	}
+	return buf.String()
+}
+
+// resetResults clears the results accumulated by a previous run.
+func resetResults() {
+	jsonOut = nil
+	jsonConsts = nil
+	jsonIfaces = nil
+	csvOut = nil
+	topTypes = nil
+	dotOut = dotGraph{}
+	summary = sizeSummary{}
+	padTotals = padSummary{}
+	tooBig = false
+	misaligned = false
+	tailPadded = false
+	matchCount = 0
+	found = make(map[string]bool)
+	generic = make(map[string]bool)
+	notTypes = make(map[string]string)
+}